@@ -2,12 +2,21 @@ package main
 
 import (
 	"boilerplate/app/controllers"
+	"boilerplate/app/middleware"
 	"boilerplate/config"
+	"boilerplate/pkg/problem"
 	"boilerplate/pkg/routes"
+	"boilerplate/pkg/secrets"
+	"boilerplate/pkg/validation"
 	"boilerplate/platform/database"
+	"boilerplate/platform/linkcache"
+	"boilerplate/platform/preview"
+	"boilerplate/platform/queue"
+	"boilerplate/platform/urlpolicy"
 
 	"flag"
 	"log"
+	"strings"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/logger"
@@ -28,24 +37,59 @@ func main() {
 	// Load configuration from environment variables
 	config.Load()
 
+	// Master key for credentials encrypted at rest
+	if err := secrets.SetMasterKey(config.Secrets.MasterKey); err != nil {
+		log.Fatal("Invalid encryption key:", err)
+	}
+
 	// Initialize database
 	database.Connect()
 
-	// Initialize rate limiter
-	controllers.InitRateLimiter()
+	// Cache code -> link lookups for redirects
+	linkcache.Start(database.GetDB(), config.Cache)
+
+	// Screen link destinations (schemes, domain rules, phishing blocklist)
+	urlpolicy.Start(database.GetDB(), config.URLPolicy)
+
+	// Fetch destination titles and favicons for the link preview page
+	preview.Start(config.Preview)
+
+	// Start outbox dispatcher for click event delivery
+	queue.StartDispatcher(database.GetDB())
+
+	// Initialize rate limiter (click events and request throttling)
+	rateLimiter := controllers.InitRateLimiter()
 
 	// Setup template engine
 	engine := html.New("./views", ".html")
 	engine.Reload(true) // Enable hot reload in development
 
 	// Create fiber app
-	app := fiber.New(fiber.Config{
+	appConfig := fiber.Config{
 		Views: engine,
-	})
+		// Validate request structs on c.Bind() using their `validate` tags
+		StructValidator: validation.New(),
+		// Returned errors are written as application/problem+json
+		ErrorHandler: problem.Handler,
+	}
+	if config.Server.TrustProxy {
+		// Resolve c.IP() from the proxy header, but only for requests coming
+		// from loopback or private addresses so clients cannot spoof it
+		appConfig.ProxyHeader = config.Server.ProxyHeader
+		appConfig.TrustProxy = true
+		appConfig.TrustProxyConfig = fiber.TrustProxyConfig{
+			Loopback: true,
+			Private:  true,
+		}
+	}
+	app := fiber.New(appConfig)
 
 	// Middleware
+	app.Use(middleware.RequestID())
 	app.Use(recover.New())
-	app.Use(logger.New())
+	app.Use(logger.New(logger.Config{
+		Format: "[${time}] ${ip} ${status} - ${latency} ${method} ${path} ${respHeader:X-Request-ID} ${error}\n",
+	}))
 
 	// Register specific routes first (more specific routes should be registered before catch-all)
 	// Health check
@@ -61,7 +105,7 @@ func main() {
 	})
 
 	// Register API and admin routes
-	routes.SetupAPI(app)
+	routes.SetupAPI(app, rateLimiter)
 	routes.SetupAuth(app)
 	routes.SetupAdmin(app)
 
@@ -69,10 +113,13 @@ func main() {
 	app.Use(static.New("./static/public"))
 
 	// Register web routes (catch-all /:code route) - must be last
-	routes.SetupWeb(app)
+	routes.SetupWeb(app, rateLimiter)
 
 	// Handle not founds
 	app.Use(func(c fiber.Ctx) error {
+		if strings.HasPrefix(c.Path(), "/api/") {
+			return problem.New(404, problem.TypeNotFound, "No API endpoint at "+c.Path())
+		}
 		return c.Status(404).SendString("Not Found")
 	})
 
@@ -1,47 +1,97 @@
 package controllers
 
 import (
+	"boilerplate/app/middleware"
+	"boilerplate/app/models"
 	"boilerplate/app/queries"
+	"boilerplate/config"
+	"boilerplate/pkg/rbac"
 	"boilerplate/platform/database"
 
 	"github.com/gofiber/fiber/v3"
 )
 
+// adminView adds the current admin user and their permissions to view data,
+// so templates can hide actions the user is not allowed to perform
+func adminView(c fiber.Ctx, data fiber.Map) fiber.Map {
+	role := ""
+	user := middleware.CurrentAdmin(c)
+	if user != nil {
+		role = user.Role
+	}
+	data["CurrentUser"] = user
+	data["Can"] = rbac.PermissionsFor(role)
+	return data
+}
+
 // Dashboard handles GET /admin
 func Dashboard(c fiber.Ctx) error {
 	db := database.GetDB()
 	linkQuery := &queries.LinkQuery{DB: db}
 	tokenQuery := &queries.APITokenQuery{DB: db}
+	outboxQuery := &queries.OutboxQuery{DB: db}
 
 	// Get stats
-	links, _, _ := linkQuery.List(10, 0, "")
+	links, _, _ := linkQuery.List(queries.LinkFilter{}, 10, 0)
 	tokens, _ := tokenQuery.List()
+	_, deadEvents, _ := outboxQuery.List(models.OutboxStatusDead, 1, 0)
 
-	return c.Render("admin/dashboard", fiber.Map{
-		"Title":  "Dashboard",
-		"Links":  links,
-		"Tokens": tokens,
-	}, "layouts/base")
+	return c.Render("admin/dashboard", adminView(c, fiber.Map{
+		"Title":      "Dashboard",
+		"Links":      links,
+		"Tokens":     tokens,
+		"DeadEvents": deadEvents,
+	}), "layouts/base")
 }
 
 // LinksPage handles GET /admin/links
 func LinksPage(c fiber.Ctx) error {
-	return c.Render("admin/links", fiber.Map{
-		"Title": "Manage Links",
-	}, "layouts/base")
+	return c.Render("admin/links", adminView(c, fiber.Map{
+		"Title":               "Manage Links",
+		"DefaultRedirectType": config.Redirect.DefaultType,
+	}), "layouts/base")
 }
 
 // TokensPage handles GET /admin/tokens
 func TokensPage(c fiber.Ctx) error {
-	return c.Render("admin/tokens", fiber.Map{
+	return c.Render("admin/tokens", adminView(c, fiber.Map{
 		"Title":   "Manage API Tokens",
 		"BaseURL": c.BaseURL(),
-	}, "layouts/base")
+	}), "layouts/base")
+}
+
+// EventsPage handles GET /admin/events
+func EventsPage(c fiber.Ctx) error {
+	return c.Render("admin/events", adminView(c, fiber.Map{
+		"Title": "Click Event Delivery",
+	}), "layouts/base")
+}
+
+// PolicyPage handles GET /admin/policy
+func PolicyPage(c fiber.Ctx) error {
+	return c.Render("admin/policy", adminView(c, fiber.Map{
+		"Title": "URL Policy",
+	}), "layouts/base")
+}
+
+// DomainsPage handles GET /admin/domains
+func DomainsPage(c fiber.Ctx) error {
+	return c.Render("admin/domains", adminView(c, fiber.Map{
+		"Title": "Short Domains",
+	}), "layouts/base")
+}
+
+// AccountPage handles GET /admin/account, where admin users change their
+// own password
+func AccountPage(c fiber.Ctx) error {
+	return c.Render("admin/account", adminView(c, fiber.Map{
+		"Title": "Account",
+	}), "layouts/base")
 }
 
 // UsersPage handles GET /admin/users
 func UsersPage(c fiber.Ctx) error {
-	return c.Render("admin/users", fiber.Map{
+	return c.Render("admin/users", adminView(c, fiber.Map{
 		"Title": "Manage Admin Users",
-	}, "layouts/base")
+	}), "layouts/base")
 }
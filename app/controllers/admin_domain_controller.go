@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"boilerplate/app/middleware"
+	"boilerplate/app/models"
+	"boilerplate/app/queries"
+	"boilerplate/pkg/problem"
+	"boilerplate/platform/database"
+	"boilerplate/platform/linkcache"
+	"boilerplate/platform/urlpolicy"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// CreateDomainRequest request struct for creating a short domain
+type CreateDomainRequest struct {
+	Host   string `json:"host" validate:"required"`
+	Scheme string `json:"scheme,omitempty" validate:"omitempty,oneof=http https"`
+	Note   string `json:"note,omitempty"`
+}
+
+// UpdateDomainRequest request struct for updating a short domain
+type UpdateDomainRequest struct {
+	Scheme string `json:"scheme" validate:"required,oneof=http https"`
+	Note   string `json:"note"`
+}
+
+// ListDomains handles GET /api/v1/admin/domains
+func ListDomains(c fiber.Ctx) error {
+	db := database.GetDB()
+	domainQuery := &queries.DomainQuery{DB: db}
+
+	domains, err := domainQuery.List()
+	if err != nil {
+		return problem.Internal("Failed to list domains", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    domains,
+	})
+}
+
+// CreateDomain handles POST /api/v1/admin/domains
+func CreateDomain(c fiber.Ctx) error {
+	var req CreateDomainRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	host, err := urlpolicy.NormalizeDomain(req.Host)
+	if err != nil || strings.Contains(req.Host, "*") {
+		return invalidField("host", "domain", "host must be a valid domain name")
+	}
+	if req.Scheme == "" {
+		req.Scheme = "https"
+	}
+
+	db := database.GetDB()
+	domainQuery := &queries.DomainQuery{DB: db}
+
+	if _, err := domainQuery.GetByHost(host); err == nil {
+		return problem.New(409, problem.TypeDomainExists, "This domain already exists")
+	}
+
+	domain := &models.Domain{
+		Host:      host,
+		Scheme:    req.Scheme,
+		Note:      strings.TrimSpace(req.Note),
+		CreatedBy: middleware.CurrentAdmin(c).Username,
+	}
+
+	if err := domainQuery.Create(domain); err != nil {
+		return problem.Internal("Failed to create domain", err)
+	}
+
+	// The host was served as the default domain until now
+	linkcache.InvalidateAll()
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    domain,
+	})
+}
+
+// UpdateDomain handles PUT /api/v1/admin/domains/:id
+func UpdateDomain(c fiber.Ctx) error {
+	id := fiber.Params[int](c, "id")
+	if id <= 0 {
+		return problem.New(400, problem.TypeInvalidID, "Invalid domain ID")
+	}
+
+	var req UpdateDomainRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	db := database.GetDB()
+	domainQuery := &queries.DomainQuery{DB: db}
+
+	if _, err := domainQuery.GetByID(uint(id)); err != nil {
+		return problem.New(404, problem.TypeDomainNotFound, "Domain not found")
+	}
+
+	if err := domainQuery.Update(uint(id), req.Scheme, strings.TrimSpace(req.Note)); err != nil {
+		return problem.Internal("Failed to update domain", err)
+	}
+
+	// Links are cached with their domain preloaded
+	linkcache.InvalidateAll()
+
+	domain, err := domainQuery.GetByID(uint(id))
+	if err != nil {
+		return problem.Internal("Failed to get updated domain", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    domain,
+	})
+}
+
+// DeleteDomain handles DELETE /api/v1/admin/domains/:id. Domains that still
+// have links or API tokens can't be deleted.
+func DeleteDomain(c fiber.Ctx) error {
+	id := fiber.Params[int](c, "id")
+	if id <= 0 {
+		return problem.New(400, problem.TypeInvalidID, "Invalid domain ID")
+	}
+
+	db := database.GetDB()
+	domainQuery := &queries.DomainQuery{DB: db}
+
+	inUse, err := domainQuery.InUse(uint(id))
+	if err != nil {
+		return problem.Internal("Failed to check domain", err)
+	}
+	if inUse {
+		return problem.New(409, problem.TypeDomainInUse, "The domain still has links or API tokens")
+	}
+
+	deleted, err := domainQuery.Delete(uint(id))
+	if err != nil {
+		return problem.Internal("Failed to delete domain", err)
+	}
+	if !deleted {
+		return problem.New(404, problem.TypeDomainNotFound, "Domain not found")
+	}
+
+	linkcache.InvalidateAll()
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Domain deleted successfully",
+	})
+}
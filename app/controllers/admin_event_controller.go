@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"boilerplate/app/models"
+	"boilerplate/app/queries"
+	"boilerplate/pkg/problem"
+	"boilerplate/platform/database"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// ListOutboxEvents handles GET /api/v1/admin/events
+func ListOutboxEvents(c fiber.Ctx) error {
+	limit := fiber.Query[int](c, "limit", 50)
+	offset := fiber.Query[int](c, "offset", 0)
+	status := fiber.Query[string](c, "status", models.OutboxStatusDead)
+
+	db := database.GetDB()
+	outboxQuery := &queries.OutboxQuery{DB: db}
+
+	events, total, err := outboxQuery.List(status, limit, offset)
+	if err != nil {
+		return problem.Internal("Failed to list events", err)
+	}
+
+	counts, err := outboxQuery.CountByStatus()
+	if err != nil {
+		return problem.Internal("Failed to count events", err)
+	}
+
+	// Only expose the token name, never its credentials
+	data := make([]fiber.Map, len(events))
+	for i, event := range events {
+		tokenName := ""
+		if event.APIToken != nil {
+			tokenName = event.APIToken.Name
+		}
+		data[i] = fiber.Map{
+			"id":              event.ID,
+			"api_token_id":    event.APITokenID,
+			"api_token_name":  tokenName,
+			"link_id":         event.LinkID,
+			"payload":         event.Payload,
+			"status":          event.Status,
+			"attempts":        event.Attempts,
+			"next_attempt_at": event.NextAttemptAt,
+			"last_error":      event.LastError,
+			"delivered_at":    event.DeliveredAt,
+			"created_at":      event.CreatedAt,
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    data,
+		"total":   total,
+		"counts":  counts,
+	})
+}
+
+// RetryOutboxEvent handles POST /api/v1/admin/events/:id/retry
+func RetryOutboxEvent(c fiber.Ctx) error {
+	id := fiber.Params[int](c, "id")
+	if id <= 0 {
+		return problem.New(400, problem.TypeInvalidID, "Invalid event ID")
+	}
+
+	db := database.GetDB()
+	outboxQuery := &queries.OutboxQuery{DB: db}
+
+	retried, err := outboxQuery.Retry(uint(id))
+	if err != nil {
+		return problem.Internal("Failed to retry event", err)
+	}
+	if !retried {
+		return problem.New(404, problem.TypeEventNotFound, "Dead-letter event not found")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Event scheduled for redelivery",
+	})
+}
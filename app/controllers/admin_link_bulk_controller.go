@@ -0,0 +1,605 @@
+package controllers
+
+import (
+	"boilerplate/app/middleware"
+	"boilerplate/app/models"
+	"boilerplate/app/queries"
+	"boilerplate/config"
+	"boilerplate/pkg/problem"
+	"boilerplate/pkg/tags"
+	"boilerplate/pkg/utils"
+	"boilerplate/pkg/validation"
+	"boilerplate/platform/database"
+	"boilerplate/platform/linkcache"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// exportColumns are the CSV columns of an export. Imports read code,
+// original_url, expires_at, max_clicks, redirect_type, forward_query,
+// interstitial, title, note, tags and password and ignore the rest, so an export can be imported
+// again. Password hashes are never exported.
+var exportColumns = []string{"code", "original_url", "short_url", "api_token_id", "expires_at", "max_clicks", "click_count", "created_at", "title", "note", "tags", "created_by", "redirect_type", "forward_query", "domain", "interstitial"}
+
+// importRow is one link of an import. Row is its 1-based position, not
+// counting the CSV header.
+type importRow struct {
+	Row  int
+	Link CreateLinkRequest
+}
+
+// importError is a row level error of an import
+type importError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// ImportLinks handles POST /api/v1/admin/links/import. The links come as a
+// CSV or JSON file upload (form field "file") or as the request body. Every
+// row is checked first; with ?dry_run=true only the report is returned,
+// otherwise all links are created, or none if any row is invalid. All links
+// go to the domain of ?domain_id, the default domain if omitted.
+func ImportLinks(c fiber.Ctx) error {
+	dryRun := fiber.Query[bool](c, "dry_run", false)
+
+	domain, err := domainByID(fiber.Query[uint](c, "domain_id", 0))
+	if err != nil {
+		return err
+	}
+
+	data, format, err := importPayload(c)
+	if err != nil {
+		return err
+	}
+
+	var rows []importRow
+	var rowErrors []importError
+	switch format {
+	case "csv":
+		rows, rowErrors, err = parseImportCSV(data)
+	case "json":
+		rows, rowErrors, err = parseImportJSON(data)
+	}
+	if err != nil {
+		return err
+	}
+
+	total := len(rows) + countRows(rowErrors)
+	if total == 0 {
+		return invalidField("file", "required", "file has no links")
+	}
+	if max := config.Bulk.ImportMaxRows; total > max {
+		return invalidField("file", "max", fmt.Sprintf("file must have at most %d links", max))
+	}
+	if max := config.Bulk.ImportMaxPasswordRows; countPasswords(rows) > max {
+		return invalidField("file", "max", fmt.Sprintf("file must have at most %d links with a password", max))
+	}
+
+	checkErrors, err := checkImportRows(c, domainID(domain), rows)
+	if err != nil {
+		return err
+	}
+	rowErrors = append(rowErrors, checkErrors...)
+	sort.SliceStable(rowErrors, func(i, j int) bool { return rowErrors[i].Row < rowErrors[j].Row })
+	invalid := countRows(rowErrors)
+
+	if dryRun {
+		return c.JSON(fiber.Map{
+			"success": invalid == 0,
+			"dry_run": true,
+			"total":   total,
+			"valid":   total - invalid,
+			"invalid": invalid,
+			"errors":  rowErrors,
+		})
+	}
+
+	if invalid > 0 {
+		return problem.New(422, problem.TypeImportInvalid, fmt.Sprintf("%d of %d rows are invalid, nothing was imported", invalid, total)).
+			With("total", total).
+			With("invalid", invalid).
+			With("errors", rowErrors)
+	}
+
+	db := database.GetDB()
+	linkQuery := &queries.LinkQuery{DB: db}
+
+	if err := assignImportCodes(linkQuery, domainID(domain), rows); err != nil {
+		return problem.Internal("Failed to generate codes", err)
+	}
+
+	admin := middleware.CurrentAdmin(c).Username
+	links := make([]models.Link, len(rows))
+	for i, row := range rows {
+		passwordHash, err := linkQuery.HashPassword(row.Link.Password)
+		if err != nil {
+			return problem.Internal("Failed to hash password", err)
+		}
+		links[i] = models.Link{
+			Code:           row.Link.Code,
+			DomainID:       domainID(domain),
+			OriginalURL:    row.Link.OriginalURL,
+			IsAPIGenerated: false, // Imported by an admin
+			ExpiresAt:      row.Link.ExpiresAt,
+			MaxClicks:      row.Link.MaxClicks,
+			RedirectType:   row.Link.RedirectType,
+			ForwardQuery:   row.Link.ForwardQuery,
+			Interstitial:   row.Link.Interstitial,
+			Title:          row.Link.Title,
+			Note:           row.Link.Note,
+			Tags:           row.Link.Tags.Normalize(),
+			PasswordHash:   passwordHash,
+			CreatedBy:      admin,
+		}
+	}
+	if err := linkQuery.CreateMany(links); err != nil {
+		return problem.Internal("Failed to import links", err)
+	}
+
+	// One purge instead of a notification per code drops cached "not found"s
+	linkcache.InvalidateAll()
+
+	log.Printf("Admin %s imported %d links", admin, len(links))
+
+	results := make([]fiber.Map, len(rows))
+	for i, row := range rows {
+		results[i] = fiber.Map{
+			"row":          row.Row,
+			"code":         links[i].Code,
+			"original_url": links[i].OriginalURL,
+		}
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success":  true,
+		"imported": len(links),
+		"data":     results,
+	})
+}
+
+// importPayload returns the uploaded file or the request body and its
+// format: the format query parameter, else the file extension or content type
+func importPayload(c fiber.Ctx) ([]byte, string, error) {
+	format := strings.ToLower(fiber.Query[string](c, "format", ""))
+
+	var data []byte
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, "", invalidField("file", "required", "file is required")
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, "", problem.Internal("Failed to read file", err)
+		}
+		defer file.Close()
+
+		data, err = io.ReadAll(file)
+		if err != nil {
+			return nil, "", problem.Internal("Failed to read file", err)
+		}
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+		}
+	} else {
+		data = c.Body()
+		if format == "" {
+			switch {
+			case strings.HasPrefix(c.Get(fiber.HeaderContentType), "text/csv"):
+				format = "csv"
+			case strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON):
+				format = "json"
+			}
+		}
+	}
+
+	if format != "csv" && format != "json" {
+		return nil, "", invalidField("format", "oneof", "format must be one of: csv, json")
+	}
+	return data, format, nil
+}
+
+// parseImportCSV reads links from CSV with a header row. Columns are matched
+// by name; unknown columns are ignored.
+func parseImportCSV(data []byte) ([]importRow, []importError, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, problem.New(400, problem.TypeInvalidBody, "Invalid CSV: "+err.Error())
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["original_url"]; !ok {
+		return nil, nil, invalidField("file", "columns", "CSV header must have an original_url column")
+	}
+
+	var rows []importRow
+	var rowErrors []importError
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, problem.New(400, problem.TypeInvalidBody, "Invalid CSV: "+err.Error())
+		}
+
+		value := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return unescapeFormula(strings.TrimSpace(record[i]))
+			}
+			return ""
+		}
+
+		link := CreateLinkRequest{
+			Code:        value("code"),
+			OriginalURL: value("original_url"),
+			Title:       value("title"),
+			Note:        value("note"),
+			Tags:        tags.Parse(value("tags")),
+			Password:    value("password"),
+		}
+		if expiresAt := value("expires_at"); expiresAt != "" {
+			t, err := time.Parse(time.RFC3339, expiresAt)
+			if err != nil {
+				rowErrors = append(rowErrors, importError{Row: row, Field: "expires_at", Type: problem.TypeValidationFailed, Message: "expires_at must be an RFC 3339 time"})
+				continue
+			}
+			link.ExpiresAt = &t
+		}
+		if maxClicks := value("max_clicks"); maxClicks != "" {
+			n, err := strconv.ParseInt(maxClicks, 10, 64)
+			if err != nil {
+				rowErrors = append(rowErrors, importError{Row: row, Field: "max_clicks", Type: problem.TypeValidationFailed, Message: "max_clicks must be a number"})
+				continue
+			}
+			link.MaxClicks = &n
+		}
+		if redirectType := value("redirect_type"); redirectType != "" {
+			n, err := strconv.Atoi(redirectType)
+			if err != nil {
+				rowErrors = append(rowErrors, importError{Row: row, Field: "redirect_type", Type: problem.TypeValidationFailed, Message: "redirect_type must be a number"})
+				continue
+			}
+			link.RedirectType = n
+		}
+		if forwardQuery := value("forward_query"); forwardQuery != "" {
+			b, err := strconv.ParseBool(forwardQuery)
+			if err != nil {
+				rowErrors = append(rowErrors, importError{Row: row, Field: "forward_query", Type: problem.TypeValidationFailed, Message: "forward_query must be true or false"})
+				continue
+			}
+			link.ForwardQuery = b
+		}
+		if interstitial := value("interstitial"); interstitial != "" {
+			b, err := strconv.ParseBool(interstitial)
+			if err != nil {
+				rowErrors = append(rowErrors, importError{Row: row, Field: "interstitial", Type: problem.TypeValidationFailed, Message: "interstitial must be true or false"})
+				continue
+			}
+			link.Interstitial = b
+		}
+
+		rows = append(rows, importRow{Row: row, Link: link})
+	}
+	return rows, rowErrors, nil
+}
+
+// parseImportJSON reads links from a JSON array of link objects
+func parseImportJSON(data []byte) ([]importRow, []importError, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, nil, problem.New(400, problem.TypeInvalidBody, "Invalid JSON: expected an array of links").Wrap(err)
+	}
+
+	var rows []importRow
+	var rowErrors []importError
+	for i, item := range items {
+		var link CreateLinkRequest
+		if err := json.Unmarshal(item, &link); err != nil {
+			rowErrors = append(rowErrors, importError{Row: i + 1, Type: problem.TypeInvalidBody, Message: "Invalid link object"})
+			continue
+		}
+		rows = append(rows, importRow{Row: i + 1, Link: link})
+	}
+	return rows, rowErrors, nil
+}
+
+// checkImportRows validates the rows like POST /api/v1/admin/links would and
+// checks custom codes against each other and the links of the domain. It
+// only returns an error when the checks themselves fail.
+func checkImportRows(c fiber.Ctx, domainID *uint, rows []importRow) ([]importError, error) {
+	validator := c.App().Config().StructValidator
+
+	// Looked up once, not for every row
+	hosts, err := ownHosts(c)
+	if err != nil {
+		return nil, problem.Internal("Failed to check URL", err)
+	}
+
+	var rowErrors []importError
+	codeRows := make(map[string]int)
+	var codes []string
+	for _, row := range rows {
+		err := validator.Validate(&row.Link)
+		if err != nil {
+			err = invalidBody(err)
+		} else if err = validateLinkLimits(row.Link.ExpiresAt, row.Link.MaxClicks); err == nil {
+			err = screenDestinationFor(c, row.Link.OriginalURL, hosts)
+		}
+		if err != nil {
+			p := problem.From(err)
+			if p.Status >= 500 {
+				return nil, p
+			}
+			rowErrors = append(rowErrors, importErrors(row.Row, p)...)
+		}
+
+		if code := row.Link.Code; code != "" {
+			if first, ok := codeRows[code]; ok {
+				rowErrors = append(rowErrors, importError{Row: row.Row, Field: "code", Type: problem.TypeCodeTaken, Message: fmt.Sprintf("code is also used in row %d", first)})
+				continue
+			}
+			codeRows[code] = row.Row
+			codes = append(codes, code)
+		}
+	}
+
+	db := database.GetDB()
+	linkQuery := &queries.LinkQuery{DB: db}
+
+	taken, err := linkQuery.ExistingCodes(domainID, codes)
+	if err != nil {
+		return nil, problem.Internal("Failed to check codes", err)
+	}
+	for _, code := range codes {
+		if taken[code] {
+			rowErrors = append(rowErrors, importError{Row: codeRows[code], Field: "code", Type: problem.TypeCodeTaken, Message: "Code already exists"})
+		}
+	}
+	return rowErrors, nil
+}
+
+// importErrors turns the problem of a row into row errors, one per invalid field
+func importErrors(row int, p *problem.Problem) []importError {
+	fields, ok := p.Extensions["errors"].([]validation.FieldError)
+	if !ok {
+		return []importError{{Row: row, Type: p.Type, Message: p.Detail}}
+	}
+
+	rowErrors := make([]importError, len(fields))
+	for i, field := range fields {
+		rowErrors[i] = importError{Row: row, Field: field.Field, Type: p.Type, Message: field.Message}
+	}
+	return rowErrors
+}
+
+// countPasswords returns the number of rows with a password
+func countPasswords(rows []importRow) int {
+	count := 0
+	for _, row := range rows {
+		if row.Link.Password != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// countRows returns the number of distinct rows with errors
+func countRows(rowErrors []importError) int {
+	seen := make(map[int]bool, len(rowErrors))
+	for _, rowError := range rowErrors {
+		seen[rowError.Row] = true
+	}
+	return len(seen)
+}
+
+// assignImportCodes generates a code unique on the domain for every row without one
+func assignImportCodes(linkQuery *queries.LinkQuery, domainID *uint, rows []importRow) error {
+	used := make(map[string]bool, len(rows))
+	var pending []int
+	for i, row := range rows {
+		if row.Link.Code != "" {
+			used[row.Link.Code] = true
+		} else {
+			pending = append(pending, i)
+		}
+	}
+
+	for len(pending) > 0 {
+		codes := make([]string, len(pending))
+		for j, i := range pending {
+			code := utils.GenerateShortCode()
+			for used[code] {
+				code = utils.GenerateShortCode()
+			}
+			used[code] = true
+			rows[i].Link.Code = code
+			codes[j] = code
+		}
+
+		taken, err := linkQuery.ExistingCodes(domainID, codes)
+		if err != nil {
+			return err
+		}
+		var retry []int
+		for _, i := range pending {
+			if taken[rows[i].Link.Code] {
+				retry = append(retry, i)
+			}
+		}
+		pending = retry
+	}
+	return nil
+}
+
+// ExportLinks handles GET /api/v1/admin/links/export. It streams every
+// matching link as CSV (default) or NDJSON (?format=ndjson), taking the
+// filters of ListLinks.
+func ExportLinks(c fiber.Ctx) error {
+	format := strings.ToLower(fiber.Query[string](c, "format", "csv"))
+	if format != "csv" && format != "ndjson" {
+		return invalidField("format", "oneof", "format must be one of: csv, ndjson")
+	}
+
+	filter, err := linkFilterFromQuery(c)
+	if err != nil {
+		return err
+	}
+
+	// The writer runs after the handler returns, so nothing may read c in it
+	baseURL := c.BaseURL()
+	admin := middleware.CurrentAdmin(c).Username
+
+	filename := "links-" + time.Now().UTC().Format("20060102-150405") + "." + format
+	c.Attachment(filename)
+	if format == "csv" {
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	} else {
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	}
+
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		db := database.GetDB()
+		linkQuery := &queries.LinkQuery{DB: db}
+
+		csvWriter := csv.NewWriter(w)
+		encoder := json.NewEncoder(w)
+		if format == "csv" {
+			csvWriter.Write(exportColumns)
+		}
+
+		count := 0
+		err := linkQuery.Export(filter, 1000, func(links []models.Link) error {
+			for i := range links {
+				record := exportRecord(baseURL, &links[i])
+				if format == "csv" {
+					csvWriter.Write(record.csv())
+				} else if err := encoder.Encode(record); err != nil {
+					return err
+				}
+			}
+			count += len(links)
+			if format == "csv" {
+				csvWriter.Flush()
+				if err := csvWriter.Error(); err != nil {
+					return err
+				}
+			}
+			// Push each batch to the client, a failed write means it went away
+			return w.Flush()
+		})
+		if err != nil {
+			log.Printf("Link export for %s stopped after %d links: %v", admin, count, err)
+			return
+		}
+		csvWriter.Flush()
+		log.Printf("Admin %s exported %d links", admin, count)
+	})
+}
+
+// linkExport is one exported link
+type linkExport struct {
+	Code         string     `json:"code"`
+	OriginalURL  string     `json:"original_url"`
+	ShortURL     string     `json:"short_url"`
+	APITokenID   *uint      `json:"api_token_id"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	MaxClicks    *int64     `json:"max_clicks"`
+	ClickCount   int64      `json:"click_count"`
+	CreatedAt    time.Time  `json:"created_at"`
+	Title        string     `json:"title"`
+	Note         string     `json:"note"`
+	Tags         tags.List  `json:"tags"`
+	CreatedBy    string     `json:"created_by"`
+	RedirectType int        `json:"redirect_type"`
+	ForwardQuery bool       `json:"forward_query"`
+	Domain       string     `json:"domain"`
+	Interstitial bool       `json:"interstitial"`
+}
+
+func exportRecord(baseURL string, link *models.Link) linkExport {
+	record := linkExport{
+		Code:         link.Code,
+		OriginalURL:  link.OriginalURL,
+		ShortURL:     shortURL(baseURL, link),
+		APITokenID:   link.APITokenID,
+		ExpiresAt:    link.ExpiresAt,
+		MaxClicks:    link.MaxClicks,
+		ClickCount:   link.ClickCount,
+		CreatedAt:    link.CreatedAt,
+		Title:        link.Title,
+		Note:         link.Note,
+		Tags:         link.Tags,
+		CreatedBy:    link.CreatedBy,
+		RedirectType: link.RedirectType,
+		ForwardQuery: link.ForwardQuery,
+		Interstitial: link.Interstitial,
+	}
+	if link.Domain != nil {
+		record.Domain = link.Domain.Host
+	}
+	return record
+}
+
+// csv returns the record in the order of exportColumns
+func (e linkExport) csv() []string {
+	record := []string{e.Code, e.OriginalURL, e.ShortURL, "", "", "", strconv.FormatInt(e.ClickCount, 10), e.CreatedAt.UTC().Format(time.RFC3339), e.Title, e.Note, e.Tags.String(), e.CreatedBy, strconv.Itoa(e.RedirectType), strconv.FormatBool(e.ForwardQuery), e.Domain, strconv.FormatBool(e.Interstitial)}
+	if e.APITokenID != nil {
+		record[3] = strconv.FormatUint(uint64(*e.APITokenID), 10)
+	}
+	if e.ExpiresAt != nil {
+		record[4] = e.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if e.MaxClicks != nil {
+		record[5] = strconv.FormatInt(*e.MaxClicks, 10)
+	}
+	for i, cell := range record {
+		record[i] = escapeFormula(cell)
+	}
+	return record
+}
+
+// formulaPrefixes start cells that spreadsheets evaluate as formulas
+const formulaPrefixes = "=+-@\t\r"
+
+// escapeFormula prefixes a cell that a spreadsheet would run as a formula,
+// e.g. a title like =HYPERLINK(...), with ' so it is shown as text.
+// unescapeFormula undoes it on import.
+func escapeFormula(cell string) string {
+	if cell != "" && strings.ContainsRune(formulaPrefixes, rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// unescapeFormula removes the ' that escapeFormula added
+func unescapeFormula(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
@@ -1,41 +1,74 @@
 package controllers
 
 import (
+	"boilerplate/app/middleware"
 	"boilerplate/app/models"
 	"boilerplate/app/queries"
+	"boilerplate/pkg/nullable"
+	"boilerplate/pkg/problem"
+	"boilerplate/pkg/tags"
 	"boilerplate/pkg/utils"
 	"boilerplate/platform/database"
+	"boilerplate/platform/linkcache"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 )
 
 // CreateLinkRequest request struct for creating link (admin)
 type CreateLinkRequest struct {
-	Code        string `json:"code,omitempty"`
-	OriginalURL string `json:"original_url" validate:"required,url"`
+	Code         string     `json:"code,omitempty" validate:"omitempty,shortcode"`
+	DomainID     uint       `json:"domain_id,omitempty"`
+	OriginalURL  string     `json:"original_url" validate:"required,url"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	MaxClicks    *int64     `json:"max_clicks,omitempty" validate:"omitempty,min=1"`
+	RedirectType int        `json:"redirect_type,omitempty" validate:"omitempty,oneof=301 302 307 308"`
+	ForwardQuery bool       `json:"forward_query,omitempty"`
+	Interstitial bool       `json:"interstitial,omitempty"`
+	Title        string     `json:"title,omitempty" validate:"max=255"`
+	Note         string     `json:"note,omitempty" validate:"max=10000"`
+	Tags         tags.List  `json:"tags,omitempty" validate:"max=20,dive,tag"`
+	Password     string     `json:"password,omitempty" validate:"omitempty,min=4,max=72"`
 }
 
-// UpdateLinkRequest request struct for updating link
+// UpdateLinkRequest request struct for updating link; omitted fields are kept
 type UpdateLinkRequest struct {
-	OriginalURL string `json:"original_url" validate:"required,url"`
+	OriginalURL  string  `json:"original_url,omitempty" validate:"omitempty,url"`
+	RedirectType *int    `json:"redirect_type,omitempty" validate:"omitempty,oneof=0 301 302 307 308"`
+	ForwardQuery *bool   `json:"forward_query,omitempty"`
+	Interstitial *bool   `json:"interstitial,omitempty"`
+	Title        *string `json:"title,omitempty" validate:"omitempty,max=255"`
+	Note         *string `json:"note,omitempty" validate:"omitempty,max=10000"`
+	// ExpiresAt and MaxClicks are removed by null; validateLinkLimits checks them
+	ExpiresAt nullable.Value[time.Time] `json:"expires_at"`
+	MaxClicks nullable.Value[int64]     `json:"max_clicks"`
+	// Tags replaces all tags of the link, an empty list removes them
+	Tags tags.List `json:"tags,omitempty" validate:"omitempty,max=20,dive,tag"`
+	// Password replaces the password of the link, "" removes it
+	Password *string `json:"password,omitempty" validate:"omitempty,min=4,max=72"`
 }
 
-// ListLinks handles GET /api/v1/admin/links
+// ListLinks handles GET /api/v1/admin/links. See linkFilterFromQuery for
+// the filters and sorting.
 func ListLinks(c fiber.Ctx) error {
 	limit := fiber.Query[int](c, "limit", 50)
 	offset := fiber.Query[int](c, "offset", 0)
-	search := fiber.Query[string](c, "search", "")
-	
+
+	filter, err := linkFilterFromQuery(c)
+	if err != nil {
+		return err
+	}
+
 	db := database.GetDB()
 	linkQuery := &queries.LinkQuery{DB: db}
-	
-	links, total, err := linkQuery.List(limit, offset, search)
+
+	links, total, err := linkQuery.List(filter, limit, offset)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to list links",
-		})
+		return problem.Internal("Failed to list links", err)
 	}
-	
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"data":    links,
@@ -43,27 +76,98 @@ func ListLinks(c fiber.Ctx) error {
 	})
 }
 
+// linkFilterFromQuery reads the link filters of the admin list and export:
+// search, tag, source (api|admin|web), token_id, domain_id (0 for the
+// default domain), created_by, created_from,
+// created_to (RFC 3339 or YYYY-MM-DD, to is exclusive), status
+// (active|inactive) and sort (a column, "-" prefixed for descending)
+func linkFilterFromQuery(c fiber.Ctx) (queries.LinkFilter, error) {
+	filter := queries.LinkFilter{
+		Search:    strings.TrimSpace(fiber.Query[string](c, "search", "")),
+		Tag:       strings.TrimSpace(fiber.Query[string](c, "tag", "")),
+		Source:    fiber.Query[string](c, "source", ""),
+		TokenID:   fiber.Query[uint](c, "token_id", 0),
+		CreatedBy: fiber.Query[string](c, "created_by", ""),
+		Status:    fiber.Query[string](c, "status", ""),
+		Sort:      fiber.Query[string](c, "sort", queries.DefaultLinkSort),
+	}
+	if value := fiber.Query[string](c, "domain_id", ""); value != "" {
+		id, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return filter, invalidField("domain_id", "number", "domain_id must be a number")
+		}
+		domainID := uint(id)
+		filter.DomainID = &domainID
+	}
+	if filter.Source != "" && filter.Source != "api" && filter.Source != "admin" && filter.Source != "web" {
+		return filter, invalidField("source", "oneof", "source must be one of: api, admin, web")
+	}
+	if filter.Status != "" && filter.Status != "active" && filter.Status != "inactive" {
+		return filter, invalidField("status", "oneof", "status must be one of: active, inactive")
+	}
+	if !queries.IsValidLinkSort(filter.Sort) {
+		return filter, invalidField("sort", "oneof", "sort must be one of: "+strings.Join(queries.LinkSorts, ", ")+", optionally prefixed with -")
+	}
+	for param, target := range map[string]**time.Time{
+		"created_from": &filter.CreatedFrom,
+		"created_to":   &filter.CreatedTo,
+	} {
+		value := fiber.Query[string](c, param, "")
+		if value == "" {
+			continue
+		}
+		t, err := parseFilterTime(value)
+		if err != nil {
+			return filter, invalidField(param, "datetime", param+" must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+		*target = &t
+	}
+	return filter, nil
+}
+
+// parseFilterTime accepts an RFC 3339 time or a YYYY-MM-DD date (UTC midnight)
+func parseFilterTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
 // CreateLink handles POST /api/v1/admin/links
 func CreateLink(c fiber.Ctx) error {
 	var req CreateLinkRequest
 	if err := c.Bind().Body(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return invalidBody(err)
+	}
+
+	if err := validateLinkLimits(req.ExpiresAt, req.MaxClicks); err != nil {
+		return err
+	}
+
+	if err := screenDestination(c, req.OriginalURL); err != nil {
+		return err
+	}
+
+	domain, err := domainByID(req.DomainID)
+	if err != nil {
+		return err
 	}
 
 	db := database.GetDB()
 	linkQuery := &queries.LinkQuery{DB: db}
 
+	passwordHash, err := linkQuery.HashPassword(req.Password)
+	if err != nil {
+		return problem.Internal("Failed to hash password", err)
+	}
+
 	code := req.Code
 	if code == "" {
 		code = utils.GenerateShortCode()
 		for {
-			exists, err := linkQuery.Exists(code)
+			exists, err := linkQuery.Exists(domainID(domain), code)
 			if err != nil {
-				return c.Status(500).JSON(fiber.Map{
-					"error": "Failed to check code",
-				})
+				return problem.Internal("Failed to check code", err)
 			}
 			if !exists {
 				break
@@ -71,73 +175,126 @@ func CreateLink(c fiber.Ctx) error {
 			code = utils.GenerateShortCode()
 		}
 	} else {
-		if !utils.ValidateCode(code) {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Invalid code format",
-			})
-		}
-
-		exists, err := linkQuery.Exists(code)
+		exists, err := linkQuery.Exists(domainID(domain), code)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to check code",
-			})
+			return problem.Internal("Failed to check code", err)
 		}
 		if exists {
-			return c.Status(409).JSON(fiber.Map{
-				"error": "Code already exists",
-			})
+			return problem.New(409, problem.TypeCodeTaken, "Code already exists")
 		}
 	}
 
 	link := &models.Link{
-		Code:            code,
-		OriginalURL:     req.OriginalURL,
-		IsAPIGenerated:  false, // Admin created links are not from API
+		Code:           code,
+		DomainID:       domainID(domain),
+		OriginalURL:    req.OriginalURL,
+		IsAPIGenerated: false, // Admin created links are not from API
+		ExpiresAt:      req.ExpiresAt,
+		MaxClicks:      req.MaxClicks,
+		RedirectType:   req.RedirectType,
+		ForwardQuery:   req.ForwardQuery,
+		Interstitial:   req.Interstitial,
+		Title:          req.Title,
+		Note:           req.Note,
+		Tags:           req.Tags.Normalize(),
+		PasswordHash:   passwordHash,
+		CreatedBy:      middleware.CurrentAdmin(c).Username,
 	}
 
 	if err := linkQuery.Create(link); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to create link",
-		})
+		return problem.Internal("Failed to create link", err)
 	}
 
+	link.Domain = domain
+
+	// Drop a cached "not found" for the code
+	linkcache.Invalidate(link.DomainID, link.Code)
+
 	return c.Status(201).JSON(fiber.Map{
 		"success": true,
 		"data":    link,
 	})
 }
 
-// UpdateLink handles PUT /api/v1/admin/links/:code
-func UpdateLink(c fiber.Ctx) error {
-	code := c.Params("code")
+// domainByID returns the domain of a domain_id field, nil for 0 (the
+// default domain). An unknown ID is a validation problem.
+func domainByID(id uint) (*models.Domain, error) {
+	if id == 0 {
+		return nil, nil
+	}
+
+	domainQuery := &queries.DomainQuery{DB: database.GetDB()}
+	domain, err := domainQuery.GetByID(id)
+	if err != nil {
+		return nil, invalidField("domain_id", "exists", "domain_id must be an existing domain")
+	}
+	return domain, nil
+}
+
+// adminLink returns the link of the :code route parameter on the domain of
+// ?domain_id (default domain if omitted)
+func adminLink(c fiber.Ctx, linkQuery *queries.LinkQuery) (*models.Link, error) {
+	var domainID *uint
+	if id := fiber.Query[uint](c, "domain_id", 0); id != 0 {
+		domainID = &id
+	}
+
+	link, err := linkQuery.GetByCode(domainID, c.Params("code"))
+	if err != nil {
+		return nil, problem.New(404, problem.TypeLinkNotFound, "Link not found")
+	}
+	return link, nil
+}
 
+// UpdateLink handles PUT /api/v1/admin/links/:code?domain_id=
+func UpdateLink(c fiber.Ctx) error {
 	var req UpdateLinkRequest
 	if err := c.Bind().Body(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return invalidBody(err)
+	}
+
+	if err := validateLinkLimits(req.ExpiresAt.Value, req.MaxClicks.Value); err != nil {
+		return err
+	}
+
+	if req.OriginalURL != "" {
+		if err := screenDestination(c, req.OriginalURL); err != nil {
+			return err
+		}
 	}
 
 	db := database.GetDB()
 	linkQuery := &queries.LinkQuery{DB: db}
 
+	existing, err := adminLink(c, linkQuery)
+	if err != nil {
+		return err
+	}
+
 	link := &models.Link{
 		OriginalURL: req.OriginalURL,
 	}
-
-	if err := linkQuery.Update(code, link); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to update link",
-		})
+	details := queries.LinkDetails{
+		ExpiresAt:    req.ExpiresAt,
+		MaxClicks:    req.MaxClicks,
+		Title:        req.Title,
+		Note:         req.Note,
+		Tags:         req.Tags.Normalize(),
+		RedirectType: req.RedirectType,
+		ForwardQuery: req.ForwardQuery,
+		Interstitial: req.Interstitial,
+		Password:     req.Password,
 	}
+	if err := linkQuery.UpdateWithDetails(existing.ID, link, details); err != nil {
+		return problem.Internal("Failed to update link", err)
+	}
+
+	linkcache.Invalidate(existing.DomainID, existing.Code)
 
 	// Get updated link
-	updatedLink, err := linkQuery.GetByCode(code)
+	updatedLink, err := linkQuery.GetByCode(existing.DomainID, existing.Code)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to get updated link",
-		})
+		return problem.Internal("Failed to get updated link", err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -146,21 +303,77 @@ func UpdateLink(c fiber.Ctx) error {
 	})
 }
 
-// DeleteLink handles DELETE /api/v1/admin/links/:code
+// DeleteLink handles DELETE /api/v1/admin/links/:code?domain_id=
 func DeleteLink(c fiber.Ctx) error {
-	code := c.Params("code")
-
 	db := database.GetDB()
 	linkQuery := &queries.LinkQuery{DB: db}
 
-	if err := linkQuery.Delete(code); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to delete link",
-		})
+	link, err := adminLink(c, linkQuery)
+	if err != nil {
+		return err
+	}
+
+	if err := linkQuery.Delete(link.ID); err != nil {
+		return problem.Internal("Failed to delete link", err)
 	}
 
+	linkcache.Invalidate(link.DomainID, link.Code)
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Link deleted successfully",
 	})
 }
+
+// GetLinkStats handles GET /api/v1/admin/links/:code/stats?domain_id=
+func GetLinkStats(c fiber.Ctx) error {
+	db := database.GetDB()
+	linkQuery := &queries.LinkQuery{DB: db}
+
+	link, err := adminLink(c, linkQuery)
+	if err != nil {
+		return err
+	}
+
+	return sendLinkStats(c, link)
+}
+
+// sendLinkStats responds with click totals, a daily series and top referrers
+// for the link over the last ?days=30 days
+func sendLinkStats(c fiber.Ctx, link *models.Link) error {
+	days := fiber.Query[int](c, "days", 30)
+	if days <= 0 || days > 365 {
+		days = 30
+	}
+
+	db := database.GetDB()
+	clickQuery := &queries.ClickQuery{DB: db}
+
+	since := time.Now().UTC().AddDate(0, 0, -(days - 1)).Truncate(24 * time.Hour)
+
+	total, err := clickQuery.CountByLink(link.ID)
+	if err != nil {
+		return problem.Internal("Failed to count clicks", err)
+	}
+
+	daily, err := clickQuery.DailyCounts(link.ID, since)
+	if err != nil {
+		return problem.Internal("Failed to get daily clicks", err)
+	}
+
+	referrers, err := clickQuery.TopReferrers(link.ID, since, 10)
+	if err != nil {
+		return problem.Internal("Failed to get top referrers", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"code":          link.Code,
+			"total_clicks":  total,
+			"days":          days,
+			"daily":         daily,
+			"top_referrers": referrers,
+		},
+	})
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"boilerplate/app/middleware"
+	"boilerplate/app/models"
+	"boilerplate/app/queries"
+	"boilerplate/config"
+	"boilerplate/pkg/problem"
+	"boilerplate/platform/database"
+	"boilerplate/platform/urlpolicy"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// CreateDomainRuleRequest request struct for creating a domain rule
+type CreateDomainRuleRequest struct {
+	Domain string `json:"domain" validate:"required"`
+	Action string `json:"action" validate:"required,oneof=block allow"`
+	Note   string `json:"note,omitempty"`
+}
+
+// GetURLPolicy handles GET /api/v1/admin/policy
+func GetURLPolicy(c fiber.Ctx) error {
+	db := database.GetDB()
+	ruleQuery := &queries.DomainRuleQuery{DB: db}
+
+	rules, err := ruleQuery.List()
+	if err != nil {
+		return problem.Internal("Failed to list domain rules", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"rules":           rules,
+			"allowed_schemes": config.URLPolicy.AllowedSchemes,
+			"own_hosts":       config.URLPolicy.OwnHosts,
+			"allowlist_only":  config.URLPolicy.AllowlistOnly,
+			"blocklist":       urlpolicy.Status(),
+		},
+	})
+}
+
+// CheckURLPolicy handles GET /api/v1/admin/policy/check?url=
+func CheckURLPolicy(c fiber.Ctx) error {
+	rawURL := fiber.Query[string](c, "url", "")
+
+	hosts, err := ownHosts(c)
+	if err != nil {
+		return problem.Internal("Failed to check URL", err)
+	}
+
+	err = urlpolicy.Check(rawURL, hosts...)
+	var violation *urlpolicy.Violation
+	if err != nil && !errors.As(err, &violation) {
+		return problem.Internal("Failed to check URL", err)
+	}
+
+	result := fiber.Map{
+		"url":     rawURL,
+		"allowed": err == nil,
+	}
+	if violation != nil {
+		result["reason"] = violation.Reason
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// CreateDomainRule handles POST /api/v1/admin/policy/rules
+func CreateDomainRule(c fiber.Ctx) error {
+	var req CreateDomainRuleRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	domain, err := urlpolicy.NormalizeDomain(req.Domain)
+	if err != nil {
+		return invalidField("domain", "domain", "domain must be a valid domain name")
+	}
+
+	db := database.GetDB()
+	ruleQuery := &queries.DomainRuleQuery{DB: db}
+
+	exists, err := ruleQuery.ExistsDomain(domain)
+	if err != nil {
+		return problem.Internal("Failed to check domain", err)
+	}
+	if exists {
+		return problem.New(409, problem.TypeRuleExists, "A rule for this domain already exists")
+	}
+
+	rule := &models.DomainRule{
+		Domain:    domain,
+		Action:    req.Action,
+		Note:      strings.TrimSpace(req.Note),
+		CreatedBy: middleware.CurrentAdmin(c).Username,
+	}
+
+	if err := ruleQuery.Create(rule); err != nil {
+		return problem.Internal("Failed to create domain rule", err)
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// DeleteDomainRule handles DELETE /api/v1/admin/policy/rules/:id
+func DeleteDomainRule(c fiber.Ctx) error {
+	id := fiber.Params[int](c, "id")
+	if id <= 0 {
+		return problem.New(400, problem.TypeInvalidID, "Invalid rule ID")
+	}
+
+	db := database.GetDB()
+	ruleQuery := &queries.DomainRuleQuery{DB: db}
+
+	deleted, err := ruleQuery.Delete(uint(id))
+	if err != nil {
+		return problem.Internal("Failed to delete domain rule", err)
+	}
+	if !deleted {
+		return problem.New(404, problem.TypeRuleNotFound, "Domain rule not found")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Domain rule deleted successfully",
+	})
+}
@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"boilerplate/app/middleware"
 	"boilerplate/app/models"
 	"boilerplate/app/queries"
+	"boilerplate/pkg/problem"
+	"boilerplate/pkg/rbac"
 	"boilerplate/platform/database"
 
 	"github.com/gofiber/fiber/v3"
@@ -12,12 +15,30 @@ import (
 type CreateAdminUserRequest struct {
 	Username string `json:"username" validate:"required"`
 	Password string `json:"password" validate:"required,min=6"`
+	Role     string `json:"role" validate:"omitempty,oneof=owner admin editor viewer"`
 }
 
 // UpdateAdminUserRequest request struct for updating admin user
 type UpdateAdminUserRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password" validate:"omitempty,min=6"`
+	Role     string `json:"role" validate:"omitempty,oneof=owner admin editor viewer"`
+}
+
+// ChangePasswordRequest request struct for changing the own password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=6"`
+}
+
+// adminUserResponse builds the public representation of an admin user (without password hash)
+func adminUserResponse(user *models.AdminUser) fiber.Map {
+	return fiber.Map{
+		"id":         user.ID,
+		"username":   user.Username,
+		"role":       user.Role,
+		"created_at": user.CreatedAt,
+	}
 }
 
 // ListAdminUsers handles GET /api/v1/admin/users
@@ -27,19 +48,13 @@ func ListAdminUsers(c fiber.Ctx) error {
 
 	users, err := userQuery.List()
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to list users",
-		})
+		return problem.Internal("Failed to list users", err)
 	}
 
 	// Remove password hash from response
 	responseUsers := make([]fiber.Map, len(users))
-	for i, user := range users {
-		responseUsers[i] = fiber.Map{
-			"id":         user.ID,
-			"username":   user.Username,
-			"created_at": user.CreatedAt,
-		}
+	for i := range users {
+		responseUsers[i] = adminUserResponse(&users[i])
 	}
 
 	return c.JSON(fiber.Map{
@@ -52,9 +67,20 @@ func ListAdminUsers(c fiber.Ctx) error {
 func CreateAdminUser(c fiber.Ctx) error {
 	var req CreateAdminUserRequest
 	if err := c.Bind().Body(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return invalidBody(err)
+	}
+
+	// New users get the least privileged role unless told otherwise
+	if req.Role == "" {
+		req.Role = rbac.RoleViewer
+	}
+	if !rbac.IsValidRole(req.Role) {
+		return invalidField("role", "oneof", "Invalid role")
+	}
+
+	actor := middleware.CurrentAdmin(c)
+	if !rbac.CanManage(actor.Role, req.Role) {
+		return problem.New(403, problem.TypeForbidden, "You cannot create users with this role")
 	}
 
 	db := database.GetDB()
@@ -63,28 +89,21 @@ func CreateAdminUser(c fiber.Ctx) error {
 	// Check if username already exists
 	_, err := userQuery.GetByUsername(req.Username)
 	if err == nil {
-		return c.Status(409).JSON(fiber.Map{
-			"error": "Username already exists",
-		})
+		return problem.New(409, problem.TypeUsernameTaken, "Username already exists")
 	}
 
 	user := &models.AdminUser{
 		Username: req.Username,
+		Role:     req.Role,
 	}
 
 	if err := userQuery.Create(user, req.Password); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to create user",
-		})
+		return problem.Internal("Failed to create user", err)
 	}
 
 	return c.Status(201).JSON(fiber.Map{
 		"success": true,
-		"data": fiber.Map{
-			"id":         user.ID,
-			"username":   user.Username,
-			"created_at": user.CreatedAt,
-		},
+		"data":    adminUserResponse(user),
 	})
 }
 
@@ -92,16 +111,12 @@ func CreateAdminUser(c fiber.Ctx) error {
 func UpdateAdminUser(c fiber.Ctx) error {
 	id := fiber.Params[int](c, "id")
 	if id <= 0 {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid user ID",
-		})
+		return problem.New(400, problem.TypeInvalidID, "Invalid user ID")
 	}
 
 	var req UpdateAdminUserRequest
 	if err := c.Bind().Body(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return invalidBody(err)
 	}
 
 	db := database.GetDB()
@@ -110,9 +125,29 @@ func UpdateAdminUser(c fiber.Ctx) error {
 	// Get existing user
 	existingUser, err := userQuery.GetByID(uint(id))
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error": "User not found",
-		})
+		return problem.New(404, problem.TypeUserNotFound, "User not found")
+	}
+
+	// Users with users:write may always edit themselves, other users only if
+	// ranked below them. Everyone else changes their password with
+	// ChangeOwnPassword.
+	actor := middleware.CurrentAdmin(c)
+	isSelf := actor.ID == existingUser.ID
+	if !isSelf && !rbac.CanManage(actor.Role, existingUser.Role) {
+		return problem.New(403, problem.TypeForbidden, "You cannot edit this user")
+	}
+
+	if req.Role != "" && req.Role != existingUser.Role {
+		if isSelf {
+			return problem.New(403, problem.TypeForbidden, "You cannot change your own role")
+		}
+		if !rbac.IsValidRole(req.Role) {
+			return invalidField("role", "oneof", "Invalid role")
+		}
+		if !rbac.CanManage(actor.Role, req.Role) {
+			return problem.New(403, problem.TypeForbidden, "You cannot assign this role")
+		}
+		existingUser.Role = req.Role
 	}
 
 	// Update username if provided
@@ -120,45 +155,103 @@ func UpdateAdminUser(c fiber.Ctx) error {
 		// Check if new username already exists (excluding current user)
 		existingWithUsername, err := userQuery.GetByUsername(req.Username)
 		if err == nil && existingWithUsername.ID != existingUser.ID {
-			return c.Status(409).JSON(fiber.Map{
-				"error": "Username already exists",
-			})
+			return problem.New(409, problem.TypeUsernameTaken, "Username already exists")
 		}
 		existingUser.Username = req.Username
 	}
 
 	if err := userQuery.Update(uint(id), existingUser, req.Password); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to update user",
-		})
+		return problem.Internal("Failed to update user", err)
+	}
+
+	// A password change signs the user out everywhere except the current session
+	if req.Password != "" {
+		if err := revokeOtherSessions(c, existingUser.ID); err != nil {
+			return problem.Internal("Failed to revoke user sessions", err)
+		}
 	}
 
 	return c.JSON(fiber.Map{
 		"success": true,
-		"data": fiber.Map{
-			"id":         existingUser.ID,
-			"username":   existingUser.Username,
-			"created_at": existingUser.CreatedAt,
-		},
+		"data":    adminUserResponse(existingUser),
 	})
 }
 
+// ChangeOwnPassword handles PUT /api/v1/admin/account/password. Every admin
+// user can change their own password, whatever their role, by confirming the
+// current one.
+func ChangeOwnPassword(c fiber.Ctx) error {
+	var req ChangePasswordRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	db := database.GetDB()
+	userQuery := &queries.AdminUserQuery{DB: db}
+
+	user, err := userQuery.GetByID(middleware.CurrentAdmin(c).ID)
+	if err != nil {
+		return problem.New(404, problem.TypeUserNotFound, "User not found")
+	}
+	if err := userQuery.ValidatePassword(user, req.CurrentPassword); err != nil {
+		return invalidField("current_password", "match", "Current password is wrong")
+	}
+
+	if err := userQuery.Update(user.ID, user, req.NewPassword); err != nil {
+		return problem.Internal("Failed to update password", err)
+	}
+	if err := revokeOtherSessions(c, user.ID); err != nil {
+		return problem.Internal("Failed to revoke user sessions", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    adminUserResponse(user),
+	})
+}
+
+// revokeOtherSessions signs a user out everywhere except the current session
+func revokeOtherSessions(c fiber.Ctx, userID uint) error {
+	var currentSessionID uint
+	if session, ok := c.Locals("admin_session").(*models.AdminSession); ok {
+		currentSessionID = session.ID
+	}
+	sessionQuery := &queries.AdminSessionQuery{DB: database.GetDB()}
+	return sessionQuery.DeleteByUser(userID, currentSessionID)
+}
+
 // DeleteAdminUser handles DELETE /api/v1/admin/users/:id
 func DeleteAdminUser(c fiber.Ctx) error {
 	id := fiber.Params[int](c, "id")
 	if id <= 0 {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid user ID",
-		})
+		return problem.New(400, problem.TypeInvalidID, "Invalid user ID")
 	}
 
 	db := database.GetDB()
 	userQuery := &queries.AdminUserQuery{DB: db}
 
+	existingUser, err := userQuery.GetByID(uint(id))
+	if err != nil {
+		return problem.New(404, problem.TypeUserNotFound, "User not found")
+	}
+
+	// Nobody can delete themselves, so at least one owner always remains
+	actor := middleware.CurrentAdmin(c)
+	if actor.ID == existingUser.ID {
+		return problem.New(403, problem.TypeForbidden, "You cannot delete your own account")
+	}
+	if !rbac.CanManage(actor.Role, existingUser.Role) {
+		return problem.New(403, problem.TypeForbidden, "You cannot delete this user")
+	}
+
 	if err := userQuery.Delete(uint(id)); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to delete user",
-		})
+		return problem.Internal("Failed to delete user", err)
+	}
+
+	// Sign the deleted user out of every session
+	sessionQuery := &queries.AdminSessionQuery{DB: db}
+	if err := sessionQuery.DeleteByUser(uint(id), 0); err != nil {
+		return problem.Internal("Failed to revoke user sessions", err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -1,46 +1,116 @@
 package controllers
 
 import (
+	"boilerplate/app/middleware"
 	"boilerplate/app/models"
 	"boilerplate/app/queries"
+	"boilerplate/pkg/nullable"
+	"boilerplate/pkg/problem"
+	"boilerplate/pkg/safehttp"
+	"boilerplate/pkg/scopes"
+	"boilerplate/pkg/secrets"
+	"boilerplate/pkg/utils"
 	"boilerplate/platform/database"
+	"boilerplate/platform/linkcache"
+	"boilerplate/platform/queue"
+	"cmp"
+	"context"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
-	"github.com/google/uuid"
 )
 
 // CreateTokenRequest request struct for creating API token
 type CreateTokenRequest struct {
-	Name             string `json:"name" validate:"required"`
-	RabbitMQHost     string `json:"rabbitmq_host"`
-	RabbitMQPort     int    `json:"rabbitmq_port"`
-	RabbitMQUser     string `json:"rabbitmq_user"`
-	RabbitMQPassword string `json:"rabbitmq_password"`
-	RabbitMQQueue    string `json:"rabbitmq_queue"`
-	RateLimitSeconds int    `json:"rate_limit_seconds"`
+	Name              string      `json:"name" validate:"required,max=255"`
+	SinkType          string      `json:"sink_type"`
+	SinkURL           string      `json:"sink_url"`
+	SinkTopic         string      `json:"sink_topic"`
+	SinkSecret        string      `json:"sink_secret"`
+	RabbitMQHost      string      `json:"rabbitmq_host"`
+	RabbitMQPort      int         `json:"rabbitmq_port" validate:"omitempty,min=1,max=65535"`
+	RabbitMQUser      string      `json:"rabbitmq_user"`
+	RabbitMQPassword  string      `json:"rabbitmq_password"`
+	RabbitMQQueue     string      `json:"rabbitmq_queue"`
+	RateLimitSeconds  int         `json:"rate_limit_seconds" validate:"omitempty,min=1"`
+	Scopes            scopes.List `json:"scopes"`
+	ExpiresAt         *time.Time  `json:"expires_at"`
+	RequestsPerMinute int         `json:"requests_per_minute" validate:"min=0"`
+	DailyLinkQuota    int         `json:"daily_link_quota" validate:"min=0"`
+	MonthlyLinkQuota  int         `json:"monthly_link_quota" validate:"min=0"`
+	DedupeLinks       bool        `json:"dedupe_links"`
+	DomainID          uint        `json:"domain_id"`
 }
 
 // UpdateTokenRequest request struct for updating API token
 type UpdateTokenRequest struct {
-	Name             string `json:"name"`
-	RabbitMQHost     string `json:"rabbitmq_host"`
-	RabbitMQPort     int    `json:"rabbitmq_port"`
-	RabbitMQUser     string `json:"rabbitmq_user"`
-	RabbitMQPassword string `json:"rabbitmq_password"`
-	RabbitMQQueue    string `json:"rabbitmq_queue"`
-	RateLimitSeconds int    `json:"rate_limit_seconds"`
+	Name              string      `json:"name" validate:"omitempty,max=255"`
+	SinkType          string      `json:"sink_type"`
+	SinkURL           string      `json:"sink_url"`
+	SinkTopic         string      `json:"sink_topic"`
+	SinkSecret        string      `json:"sink_secret"`
+	RabbitMQHost      string      `json:"rabbitmq_host"`
+	RabbitMQPort      int         `json:"rabbitmq_port" validate:"omitempty,min=1,max=65535"`
+	RabbitMQUser      string      `json:"rabbitmq_user"`
+	RabbitMQPassword  string      `json:"rabbitmq_password"`
+	RabbitMQQueue     string      `json:"rabbitmq_queue"`
+	RateLimitSeconds  int         `json:"rate_limit_seconds" validate:"omitempty,min=1"`
+	Scopes            scopes.List `json:"scopes"`
+	RequestsPerMinute *int        `json:"requests_per_minute" validate:"omitempty,min=0"`
+	DailyLinkQuota    *int        `json:"daily_link_quota" validate:"omitempty,min=0"`
+	MonthlyLinkQuota  *int        `json:"monthly_link_quota" validate:"omitempty,min=0"`
+	DedupeLinks       *bool       `json:"dedupe_links"`
+	// DomainID moves the token's new links to a domain, 0 for the default domain
+	DomainID *uint `json:"domain_id"`
+
+	// ExpiresAt is left alone when omitted, null removes the expiry
+	ExpiresAt nullable.Value[time.Time] `json:"expires_at"`
+}
+
+// RevokeTokenRequest request struct for revoking API token
+type RevokeTokenRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+// validateTokenAccess checks the scopes and expiry of a token request and
+// returns a validation problem when they are invalid
+func validateTokenAccess(tokenScopes scopes.List, expiresAt *time.Time) error {
+	if tokenScopes != nil {
+		if len(tokenScopes) == 0 {
+			return invalidField("scopes", "required", "At least one scope is required")
+		}
+		if err := tokenScopes.Validate(); err != nil {
+			return invalidField("scopes", "scope", "Invalid scopes: "+err.Error())
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return invalidField("expires_at", "future", "expires_at must be in the future")
+	}
+	return nil
+}
+
+// tokenWithSecret is an API token together with its plaintext secret. It is
+// only ever returned by CreateToken and RotateToken; the secret is not stored.
+type tokenWithSecret struct {
+	*models.APIToken
+	Token string `json:"token"`
 }
 
 // CreateToken handles POST /api/v1/admin/tokens
 func CreateToken(c fiber.Ctx) error {
 	var req CreateTokenRequest
 	if err := c.Bind().Body(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return invalidBody(err)
 	}
 
 	// Set defaults
+	if req.SinkType == "" {
+		req.SinkType = queue.SinkRabbitMQ
+	}
+	if !queue.IsValidSinkType(req.SinkType) {
+		return invalidField("sink_type", "oneof", "Invalid sink type")
+	}
 	if req.RabbitMQPort == 0 {
 		req.RabbitMQPort = 5672
 	}
@@ -50,31 +120,61 @@ func CreateToken(c fiber.Ctx) error {
 	if req.RabbitMQQueue == "" {
 		req.RabbitMQQueue = "click_events"
 	}
+	if req.Scopes == nil {
+		req.Scopes = scopes.All
+	}
+	if err := validateTokenAccess(req.Scopes, req.ExpiresAt); err != nil {
+		return err
+	}
+	if err := validateSink(c, req.SinkType, req.SinkURL, req.RabbitMQHost); err != nil {
+		return err
+	}
+
+	domain, err := domainByID(req.DomainID)
+	if err != nil {
+		return err
+	}
 
 	db := database.GetDB()
 	tokenQuery := &queries.APITokenQuery{DB: db}
 
-	// Generate token
+	// Generate token; only its hash and lookup prefix are stored
+	secret, err := utils.GenerateAPIToken()
+	if err != nil {
+		return problem.Internal("Failed to generate token", err)
+	}
+
 	token := &models.APIToken{
-		Token:            uuid.New().String(),
-		Name:             req.Name,
-		RabbitMQHost:     req.RabbitMQHost,
-		RabbitMQPort:     req.RabbitMQPort,
-		RabbitMQUser:     req.RabbitMQUser,
-		RabbitMQPassword: req.RabbitMQPassword,
-		RabbitMQQueue:    req.RabbitMQQueue,
-		RateLimitSeconds: req.RateLimitSeconds,
+		TokenHash:         utils.HashToken(secret),
+		TokenPrefix:       utils.TokenPrefix(secret),
+		Name:              req.Name,
+		SinkType:          req.SinkType,
+		SinkURL:           req.SinkURL,
+		SinkTopic:         req.SinkTopic,
+		SinkSecret:        secrets.EncryptedString(req.SinkSecret),
+		RabbitMQHost:      req.RabbitMQHost,
+		RabbitMQPort:      req.RabbitMQPort,
+		RabbitMQUser:      req.RabbitMQUser,
+		RabbitMQPassword:  secrets.EncryptedString(req.RabbitMQPassword),
+		RabbitMQQueue:     req.RabbitMQQueue,
+		RateLimitSeconds:  req.RateLimitSeconds,
+		Scopes:            req.Scopes,
+		ExpiresAt:         req.ExpiresAt,
+		RequestsPerMinute: req.RequestsPerMinute,
+		DailyLinkQuota:    req.DailyLinkQuota,
+		MonthlyLinkQuota:  req.MonthlyLinkQuota,
+		DedupeLinks:       req.DedupeLinks,
+		DomainID:          domainID(domain),
 	}
 
 	if err := tokenQuery.Create(token); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to create token",
-		})
+		return problem.Internal("Failed to create token", err)
 	}
+	token.Domain = domain
 
 	return c.Status(201).JSON(fiber.Map{
 		"success": true,
-		"data":    token,
+		"data":    tokenWithSecret{APIToken: token, Token: secret},
 	})
 }
 
@@ -85,9 +185,7 @@ func ListTokens(c fiber.Ctx) error {
 
 	tokens, err := tokenQuery.List()
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to list tokens",
-		})
+		return problem.Internal("Failed to list tokens", err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -100,16 +198,12 @@ func ListTokens(c fiber.Ctx) error {
 func UpdateToken(c fiber.Ctx) error {
 	id := fiber.Params[int](c, "id")
 	if id <= 0 {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid token ID",
-		})
+		return problem.New(400, problem.TypeInvalidID, "Invalid token ID")
 	}
 
 	var req UpdateTokenRequest
 	if err := c.Bind().Body(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return invalidBody(err)
 	}
 
 	db := database.GetDB()
@@ -118,15 +212,50 @@ func UpdateToken(c fiber.Ctx) error {
 	// Get existing token
 	existingToken, err := tokenQuery.GetByID(uint(id))
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error": "Token not found",
-		})
+		return problem.New(404, problem.TypeTokenNotFound, "Token not found")
 	}
 
+	if req.SinkType != "" && !queue.IsValidSinkType(req.SinkType) {
+		return invalidField("sink_type", "oneof", "Invalid sink type")
+	}
+	if err := validateTokenAccess(req.Scopes, req.ExpiresAt.Value); err != nil {
+		return err
+	}
+	if req.SinkType != "" || req.SinkURL != "" || req.RabbitMQHost != "" {
+		sinkType := cmp.Or(req.SinkType, existingToken.SinkType, queue.SinkRabbitMQ)
+		sinkURL := cmp.Or(req.SinkURL, existingToken.SinkURL)
+		rabbitMQHost := cmp.Or(req.RabbitMQHost, existingToken.RabbitMQHost)
+		if err := validateSink(c, sinkType, sinkURL, rabbitMQHost); err != nil {
+			return err
+		}
+	}
+
+	var domain *models.Domain
+	if req.DomainID != nil {
+		if domain, err = domainByID(*req.DomainID); err != nil {
+			return err
+		}
+	}
+
+	// Drop the pooled sink for the old config, it is recreated on next click
+	queue.CloseSink(existingToken)
+
 	// Update fields
 	if req.Name != "" {
 		existingToken.Name = req.Name
 	}
+	if req.SinkType != "" {
+		existingToken.SinkType = req.SinkType
+	}
+	if req.SinkURL != "" {
+		existingToken.SinkURL = req.SinkURL
+	}
+	if req.SinkTopic != "" {
+		existingToken.SinkTopic = req.SinkTopic
+	}
+	if req.SinkSecret != "" {
+		existingToken.SinkSecret = secrets.EncryptedString(req.SinkSecret)
+	}
 	if req.RabbitMQHost != "" {
 		existingToken.RabbitMQHost = req.RabbitMQHost
 	}
@@ -137,7 +266,7 @@ func UpdateToken(c fiber.Ctx) error {
 		existingToken.RabbitMQUser = req.RabbitMQUser
 	}
 	if req.RabbitMQPassword != "" {
-		existingToken.RabbitMQPassword = req.RabbitMQPassword
+		existingToken.RabbitMQPassword = secrets.EncryptedString(req.RabbitMQPassword)
 	}
 	if req.RabbitMQQueue != "" {
 		existingToken.RabbitMQQueue = req.RabbitMQQueue
@@ -145,37 +274,223 @@ func UpdateToken(c fiber.Ctx) error {
 	if req.RateLimitSeconds > 0 {
 		existingToken.RateLimitSeconds = req.RateLimitSeconds
 	}
+	if req.Scopes != nil {
+		existingToken.Scopes = req.Scopes
+	}
+	if req.ExpiresAt.Set {
+		existingToken.ExpiresAt = req.ExpiresAt.Value
+	}
+	if req.RequestsPerMinute != nil {
+		existingToken.RequestsPerMinute = *req.RequestsPerMinute
+	}
+	if req.DailyLinkQuota != nil {
+		existingToken.DailyLinkQuota = *req.DailyLinkQuota
+	}
+	if req.MonthlyLinkQuota != nil {
+		existingToken.MonthlyLinkQuota = *req.MonthlyLinkQuota
+	}
+	if req.DedupeLinks != nil {
+		existingToken.DedupeLinks = *req.DedupeLinks
+	}
 
 	if err := tokenQuery.Update(uint(id), existingToken); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to update token",
-		})
+		return problem.Internal("Failed to update token", err)
 	}
 
+	// Limits may be set back to 0, dedupe turned off and the expiry removed,
+	// which Update skips
+	err = tokenQuery.UpdateLimits(uint(id), existingToken.RequestsPerMinute, existingToken.DailyLinkQuota, existingToken.MonthlyLinkQuota, existingToken.DedupeLinks, existingToken.ExpiresAt)
+	if err != nil {
+		return problem.Internal("Failed to update token", err)
+	}
+
+	if req.DomainID != nil {
+		if err := tokenQuery.SetDomain(uint(id), domainID(domain)); err != nil {
+			return problem.Internal("Failed to update token", err)
+		}
+		existingToken.DomainID = domainID(domain)
+		existingToken.Domain = domain
+	}
+
+	// Links are cached with their token preloaded
+	linkcache.InvalidateAll()
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"data":    existingToken,
 	})
 }
 
+// RotateToken handles POST /api/v1/admin/tokens/:id/rotate
+func RotateToken(c fiber.Ctx) error {
+	id := fiber.Params[int](c, "id")
+	if id <= 0 {
+		return problem.New(400, problem.TypeInvalidID, "Invalid token ID")
+	}
+
+	db := database.GetDB()
+	tokenQuery := &queries.APITokenQuery{DB: db}
+
+	token, err := tokenQuery.GetByID(uint(id))
+	if err != nil {
+		return problem.New(404, problem.TypeTokenNotFound, "Token not found")
+	}
+
+	if token.IsRevoked() {
+		return problem.New(409, problem.TypeTokenRevoked, "Token has been revoked")
+	}
+
+	// The old secret stops working as soon as the new hash is stored
+	secret, err := utils.GenerateAPIToken()
+	if err != nil {
+		return problem.Internal("Failed to generate token", err)
+	}
+	token.TokenHash = utils.HashToken(secret)
+	token.TokenPrefix = utils.TokenPrefix(secret)
+
+	if err := tokenQuery.UpdateSecret(token.ID, token.TokenHash, token.TokenPrefix); err != nil {
+		return problem.Internal("Failed to rotate token", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    tokenWithSecret{APIToken: token, Token: secret},
+	})
+}
+
+// RevokeToken handles POST /api/v1/admin/tokens/:id/revoke
+func RevokeToken(c fiber.Ctx) error {
+	id := fiber.Params[int](c, "id")
+	if id <= 0 {
+		return problem.New(400, problem.TypeInvalidID, "Invalid token ID")
+	}
+
+	var req RevokeTokenRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return invalidBody(err)
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return invalidField("reason", "required", "A revocation reason is required")
+	}
+
+	db := database.GetDB()
+	tokenQuery := &queries.APITokenQuery{DB: db}
+
+	if _, err := tokenQuery.GetByID(uint(id)); err != nil {
+		return problem.New(404, problem.TypeTokenNotFound, "Token not found")
+	}
+
+	revoked, err := tokenQuery.Revoke(uint(id), req.Reason, middleware.CurrentAdmin(c).Username)
+	if err != nil {
+		return problem.Internal("Failed to revoke token", err)
+	}
+	if !revoked {
+		return problem.New(409, problem.TypeTokenRevoked, "Token is already revoked")
+	}
+
+	token, err := tokenQuery.GetByID(uint(id))
+	if err != nil {
+		return problem.Internal("Failed to get revoked token", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    token,
+	})
+}
+
+// TestTokenConnection handles POST /api/v1/admin/tokens/:id/test
+func TestTokenConnection(c fiber.Ctx) error {
+	id := fiber.Params[int](c, "id")
+	if id <= 0 {
+		return problem.New(400, problem.TypeInvalidID, "Invalid token ID")
+	}
+
+	db := database.GetDB()
+	tokenQuery := &queries.APITokenQuery{DB: db}
+
+	token, err := tokenQuery.GetByID(uint(id))
+	if err != nil {
+		return problem.New(404, problem.TypeTokenNotFound, "Token not found")
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := queue.TestSink(ctx, token); err != nil {
+		return problem.New(502, problem.TypeSinkUnreachable, "Connection failed: "+redactSecrets(err.Error(), token))
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Connection successful",
+	})
+}
+
+// validateSink screens where a token's events go. File sinks take a file
+// name inside FILE_SINK_DIR; webhook and Kafka URLs must pass the URL policy;
+// no network sink may point to internal addresses.
+func validateSink(c fiber.Ctx, sinkType, sinkURL, rabbitMQHost string) error {
+	switch sinkType {
+	case queue.SinkFile:
+		if _, err := queue.FileSinkPath(sinkURL); err != nil {
+			return invalidField("sink_url", "file_name", err.Error())
+		}
+	case queue.SinkWebhook, queue.SinkKafka:
+		if sinkURL == "" {
+			return nil
+		}
+		if err := safehttp.CheckURL(sinkURL); err != nil {
+			return invalidField("sink_url", "public_url", "sink_url "+err.Error())
+		}
+		return screenDestination(c, sinkURL)
+	case queue.SinkNATS:
+		if sinkURL == "" {
+			return nil
+		}
+		if err := queue.CheckNATSURL(sinkURL); err != nil {
+			return invalidField("sink_url", "public_url", "sink_url "+err.Error())
+		}
+	case queue.SinkRabbitMQ, "":
+		if rabbitMQHost == "" {
+			return nil
+		}
+		if err := safehttp.CheckHost(rabbitMQHost); err != nil {
+			return invalidField("rabbitmq_host", "public_host", "rabbitmq_host "+err.Error())
+		}
+	}
+	return nil
+}
+
+// redactSecrets masks the token's decrypted secrets in a message, in case a
+// driver error echoes back a connection URL
+func redactSecrets(message string, token *models.APIToken) string {
+	for _, secret := range []secrets.EncryptedString{token.SinkSecret, token.RabbitMQPassword} {
+		if secret != "" {
+			message = strings.ReplaceAll(message, string(secret), secrets.Redacted)
+		}
+	}
+	return message
+}
+
 // DeleteToken handles DELETE /api/v1/admin/tokens/:id
 func DeleteToken(c fiber.Ctx) error {
 	id := fiber.Params[int](c, "id")
 	if id <= 0 {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid token ID",
-		})
+		return problem.New(400, problem.TypeInvalidID, "Invalid token ID")
 	}
 
 	db := database.GetDB()
 	tokenQuery := &queries.APITokenQuery{DB: db}
 
 	if err := tokenQuery.Delete(uint(id)); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to delete token",
-		})
+		return problem.Internal("Failed to delete token", err)
 	}
 
+	// Links are cached with their token preloaded
+	linkcache.InvalidateAll()
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Token deleted successfully",
@@ -1,8 +1,14 @@
 package controllers
 
 import (
+	"boilerplate/app/middleware"
+	"boilerplate/app/models"
 	"boilerplate/app/queries"
+	"boilerplate/config"
+	"boilerplate/pkg/problem"
+	"boilerplate/pkg/utils"
 	"boilerplate/platform/database"
+	"log"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
@@ -18,39 +24,55 @@ type LoginRequest struct {
 func Login(c fiber.Ctx) error {
 	var req LoginRequest
 	if err := c.Bind().Body(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return invalidBody(err)
 	}
 
 	db := database.GetDB()
 	userQuery := &queries.AdminUserQuery{DB: db}
+	sessionQuery := &queries.AdminSessionQuery{DB: db}
 
 	user, err := userQuery.GetByUsername(req.Username)
 	if err != nil {
-		return c.Status(401).JSON(fiber.Map{
-			"error": "Invalid credentials",
-		})
+		return problem.New(401, problem.TypeInvalidCredentials, "Invalid credentials")
 	}
 
 	if err := userQuery.ValidatePassword(user, req.Password); err != nil {
-		return c.Status(401).JSON(fiber.Map{
-			"error": "Invalid credentials",
-		})
+		return problem.New(401, problem.TypeInvalidCredentials, "Invalid credentials")
 	}
 
-	// Set session cookie
-	c.Cookie(&fiber.Cookie{
-		Name:     "admin_authenticated",
-		Value:    "true",
-		HTTPOnly: true,
-		SameSite: "Lax",
-	})
+	// Generate a random session ID; only its hash is stored
+	sessionID, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return problem.Internal("Failed to create session", err)
+	}
+
+	now := time.Now().UTC()
+	session := &models.AdminSession{
+		TokenHash:   utils.HashToken(sessionID),
+		AdminUserID: user.ID,
+		ExpiresAt:   now.Add(config.Session.TTL),
+		LastSeenAt:  now,
+		IP:          c.IP(),
+		UserAgent:   c.Get("User-Agent"),
+	}
+
+	if err := sessionQuery.Create(session); err != nil {
+		return problem.Internal("Failed to create session", err)
+	}
 
+	// Opportunistically clean up stale sessions
+	if err := sessionQuery.DeleteExpired(now, now.Add(-config.Session.IdleTimeout)); err != nil {
+		log.Printf("Failed to delete expired sessions: %v", err)
+	}
+
+	// Set session cookie
 	c.Cookie(&fiber.Cookie{
-		Name:     "admin_username",
-		Value:    user.Username,
+		Name:     middleware.AdminSessionCookie,
+		Value:    sessionID,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
 		HTTPOnly: true,
+		Secure:   config.Session.CookieSecure,
 		SameSite: "Lax",
 	})
 
@@ -62,18 +84,24 @@ func Login(c fiber.Ctx) error {
 
 // Logout handles POST /admin/logout
 func Logout(c fiber.Ctx) error {
-	c.Cookie(&fiber.Cookie{
-		Name:     "admin_authenticated",
-		Value:    "",
-		HTTPOnly: true,
-		SameSite: "Lax",
-		Expires:  time.Unix(0, 0),
-	})
+	// Invalidate the server-side session so the cookie can't be replayed
+	if sessionID := c.Cookies(middleware.AdminSessionCookie); sessionID != "" {
+		db := database.GetDB()
+		sessionQuery := &queries.AdminSessionQuery{DB: db}
+
+		if session, err := sessionQuery.GetByTokenHash(utils.HashToken(sessionID)); err == nil {
+			if err := sessionQuery.Delete(session.ID); err != nil {
+				return problem.Internal("Failed to end session", err)
+			}
+		}
+	}
 
 	c.Cookie(&fiber.Cookie{
-		Name:     "admin_username",
+		Name:     middleware.AdminSessionCookie,
 		Value:    "",
+		Path:     "/",
 		HTTPOnly: true,
+		Secure:   config.Session.CookieSecure,
 		SameSite: "Lax",
 		Expires:  time.Unix(0, 0),
 	})
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"boilerplate/app/middleware"
+	"boilerplate/app/models"
+	"boilerplate/app/queries"
+	"boilerplate/config"
+	"boilerplate/pkg/problem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// CreateShortLinkBatchRequest request struct for creating several short links.
+// Items are validated one by one, so one bad item doesn't fail the batch.
+type CreateShortLinkBatchRequest struct {
+	Links []CreateShortLinkRequest `json:"links" validate:"required,min=1"`
+}
+
+// CreateShortLinkBatch handles POST /api/v1/links/batch. Every item is
+// created like POST /api/v1/links on its own; the response lists a result per
+// item, in request order, with the link or the problem that stopped it.
+func CreateShortLinkBatch(c fiber.Ctx) error {
+	var req CreateShortLinkBatchRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return invalidBody(err)
+	}
+	if max := config.Bulk.BatchMaxItems; len(req.Links) > max {
+		return invalidField("links", "max", fmt.Sprintf("links must have at most %d items", max))
+	}
+
+	apiToken := c.Locals("api_token").(*models.APIToken)
+	validator := c.App().Config().StructValidator
+
+	results := make([]fiber.Map, len(req.Links))
+	created, deduplicated, failed := 0, 0, 0
+	for i := range req.Links {
+		item := &req.Links[i]
+
+		err := validator.Validate(item)
+		if err != nil {
+			err = invalidBody(err)
+		}
+
+		var link *models.Link
+		var reused bool
+		if err == nil {
+			link, reused, err = createTokenLink(c, apiToken, item)
+		}
+
+		switch {
+		case err != nil:
+			p := batchItemProblem(err)
+			problem.Log(c, p)
+			results[i] = fiber.Map{"index": i, "status": p.Status, "error": p.Body()}
+			failed++
+		case reused:
+			results[i] = fiber.Map{"index": i, "status": fiber.StatusOK, "deduplicated": true, "data": shortLinkResponse(c, link)}
+			deduplicated++
+		default:
+			results[i] = fiber.Map{"index": i, "status": fiber.StatusCreated, "data": shortLinkResponse(c, link)}
+			created++
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"success":      failed == 0,
+		"data":         results,
+		"created":      created,
+		"deduplicated": deduplicated,
+		"failed":       failed,
+	})
+}
+
+// batchItemProblem turns the error of one batch item into a problem. A used
+// up quota doesn't set the Retry-After header, as the batch itself succeeded.
+func batchItemProblem(err error) *problem.Problem {
+	var quotaErr *queries.QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		return middleware.RetryLater(time.Until(quotaErr.Quota.Until), problem.TypeQuotaExceeded, quotaErr.Error())
+	}
+	return problem.From(err)
+}
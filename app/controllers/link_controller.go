@@ -1,56 +1,198 @@
 package controllers
 
 import (
+	"boilerplate/app/middleware"
 	"boilerplate/app/models"
 	"boilerplate/app/queries"
+	"boilerplate/config"
+	"boilerplate/pkg/problem"
 	"boilerplate/pkg/ratelimiter"
+	"boilerplate/pkg/tags"
 	"boilerplate/pkg/utils"
 	"boilerplate/platform/database"
+	"boilerplate/platform/linkcache"
 	"boilerplate/platform/queue"
+	"boilerplate/platform/urlpolicy"
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 )
 
 var globalRateLimiter *ratelimiter.RateLimiter
 
-// InitRateLimiter initializes the global rate limiter
-func InitRateLimiter() {
-	globalRateLimiter = ratelimiter.NewRateLimiter()
+// InitRateLimiter initializes the global rate limiter with the configured store.
+// It is also returned so routes can throttle requests with it.
+func InitRateLimiter() *ratelimiter.RateLimiter {
+	switch config.RateLimit.Store {
+	case "memory":
+		globalRateLimiter = ratelimiter.NewRateLimiter()
+	case "postgres":
+		store, err := ratelimiter.NewPostgresStore(database.GetDB())
+		if err != nil {
+			log.Fatal("Failed to create rate limiter store:", err)
+		}
+		globalRateLimiter = ratelimiter.New(store)
+	default:
+		log.Fatalf("Unknown RATE_LIMIT_STORE %q, use postgres or memory", config.RateLimit.Store)
+	}
+	return globalRateLimiter
 }
 
 // CreateShortLinkRequest request struct for creating short link
 type CreateShortLinkRequest struct {
-	OriginalURL string `json:"original_url" validate:"required,url"`
-	Code        string `json:"code,omitempty" validate:"omitempty,min=4,max=20"`
+	OriginalURL  string     `json:"original_url" validate:"required,url"`
+	Code         string     `json:"code,omitempty" validate:"omitempty,shortcode"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	MaxClicks    *int64     `json:"max_clicks,omitempty" validate:"omitempty,min=1"`
+	RedirectType int        `json:"redirect_type,omitempty" validate:"omitempty,oneof=301 302 307 308"`
+	ForwardQuery bool       `json:"forward_query,omitempty"`
+	Interstitial bool       `json:"interstitial,omitempty"`
+	Title        string     `json:"title,omitempty" validate:"max=255"`
+	Note         string     `json:"note,omitempty" validate:"max=10000"`
+	Tags         tags.List  `json:"tags,omitempty" validate:"max=20,dive,tag"`
+	// Password makes visitors enter it before they are redirected
+	Password string `json:"password,omitempty" validate:"omitempty,min=4,max=72"`
+	// Dedupe overrides the token's DedupeLinks setting for this request
+	Dedupe *bool `json:"dedupe,omitempty"`
+}
+
+// screenDestination checks a link destination against the URL policy and
+// returns a 400 problem typed by the violated rule if it is rejected
+func screenDestination(c fiber.Ctx, rawURL string) error {
+	hosts, err := ownHosts(c)
+	if err != nil {
+		return problem.Internal("Failed to check URL", err)
+	}
+	return screenDestinationFor(c, rawURL, hosts)
+}
+
+// screenDestinationFor is screenDestination with the own hosts already
+// looked up, for checking many URLs at once
+func screenDestinationFor(c fiber.Ctx, rawURL string, hosts []string) error {
+	err := urlpolicy.Check(rawURL, hosts...)
+	if err == nil {
+		return nil
+	}
+
+	var violation *urlpolicy.Violation
+	if errors.As(err, &violation) {
+		log.Printf("Rejected link destination %q from %s: %s", rawURL, c.IP(), violation.Reason)
+		return problem.New(400, violation.Type, violation.Reason)
+	}
+	return problem.Internal("Failed to check URL", err)
+}
+
+// ownHosts returns the request host and the hosts of all short domains, which
+// links must not point to since they would loop
+func ownHosts(c fiber.Ctx) ([]string, error) {
+	domainQuery := &queries.DomainQuery{DB: database.GetDB()}
+	hosts, err := domainQuery.Hosts()
+	if err != nil {
+		return nil, err
+	}
+	return append(hosts, c.Hostname()), nil
+}
+
+// validateLinkLimits checks the optional lifetime fields of a link request
+// and returns a validation problem when they are invalid
+func validateLinkLimits(expiresAt *time.Time, maxClicks *int64) error {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return invalidField("expires_at", "future", "expires_at must be in the future")
+	}
+	if maxClicks != nil && *maxClicks < 1 {
+		return invalidField("max_clicks", "min", "max_clicks must be at least 1")
+	}
+	return nil
+}
+
+// linkGoneReason returns why a link can no longer be followed, or "" if it is still active
+func linkGoneReason(link *models.Link) string {
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		return "expired"
+	}
+	if link.MaxClicks != nil && link.ClickCount >= *link.MaxClicks {
+		return "exhausted"
+	}
+	return ""
+}
+
+// renderGone renders the 410 Gone page for expired or exhausted links
+func renderGone(c fiber.Ctx, reason string) error {
+	return c.Status(fiber.StatusGone).Render("gone", fiber.Map{
+		"Title":  "Link no longer available",
+		"Reason": reason,
+	})
 }
 
 // CreateShortLink handles POST /api/v1/links
 func CreateShortLink(c fiber.Ctx) error {
 	var req CreateShortLinkRequest
 	if err := c.Bind().Body(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return invalidBody(err)
 	}
 
 	// Get API token from middleware
 	apiToken := c.Locals("api_token").(*models.APIToken)
-	_ = apiToken // Use token if needed for future features
+
+	link, deduplicated, err := createTokenLink(c, apiToken, &req)
+	if err != nil {
+		var quotaErr *queries.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			resetIn := time.Until(quotaErr.Quota.Until)
+			middleware.SetRateLimitHeaders(c, quotaErr.Quota.Limit, 0, resetIn)
+			return middleware.TooManyRequests(c, resetIn, problem.TypeQuotaExceeded, quotaErr.Error())
+		}
+		return err
+	}
+	if deduplicated {
+		return c.JSON(fiber.Map{
+			"success":      true,
+			"deduplicated": true,
+			"data":         shortLinkResponse(c, link),
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    shortLinkResponse(c, link),
+	})
+}
+
+// createTokenLink creates a link for an API token from a validated request.
+// deduplicated reports that an existing link was returned instead. A used up
+// quota is returned as *queries.QuotaExceededError, other failures as problems.
+func createTokenLink(c fiber.Ctx, apiToken *models.APIToken, req *CreateShortLinkRequest) (link *models.Link, deduplicated bool, err error) {
+	if err := validateLinkLimits(req.ExpiresAt, req.MaxClicks); err != nil {
+		return nil, false, err
+	}
+
+	if err := screenDestination(c, req.OriginalURL); err != nil {
+		return nil, false, err
+	}
 
 	db := database.GetDB()
 	linkQuery := &queries.LinkQuery{DB: db}
 
-	// Generate code if not provided
+	passwordHash, err := linkQuery.HashPassword(req.Password)
+	if err != nil {
+		return nil, false, problem.Internal("Failed to hash password", err)
+	}
+
+	// Generate code if not provided, unique on the token's domain
 	code := req.Code
 	if code == "" {
 		code = utils.GenerateShortCode()
 		// Ensure uniqueness
 		for {
-			exists, err := linkQuery.Exists(code)
+			exists, err := linkQuery.Exists(apiToken.DomainID, code)
 			if err != nil {
-				return c.Status(500).JSON(fiber.Map{
-					"error": "Failed to check code uniqueness",
-				})
+				return nil, false, problem.Internal("Failed to check code uniqueness", err)
 			}
 			if !exists {
 				break
@@ -58,77 +200,444 @@ func CreateShortLink(c fiber.Ctx) error {
 			code = utils.GenerateShortCode()
 		}
 	} else {
-		// Validate custom code
-		if !utils.ValidateCode(code) {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Invalid code format",
-			})
-		}
-
 		// Check if code exists
-		exists, err := linkQuery.Exists(code)
+		exists, err := linkQuery.Exists(apiToken.DomainID, code)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to check code",
-			})
+			return nil, false, problem.Internal("Failed to check code", err)
 		}
 		if exists {
-			return c.Status(409).JSON(fiber.Map{
-				"error": "Code already exists",
-			})
+			return nil, false, problem.New(409, problem.TypeCodeTaken, "Code already exists")
 		}
 	}
 
 	// Create link (from API, so IsAPIGenerated = true)
-	link := &models.Link{
-		Code:            code,
-		OriginalURL:     req.OriginalURL,
-		IsAPIGenerated:  true,
-		APITokenID:      &apiToken.ID,
+	link = &models.Link{
+		Code:           code,
+		DomainID:       apiToken.DomainID,
+		OriginalURL:    req.OriginalURL,
+		IsAPIGenerated: true,
+		APITokenID:     &apiToken.ID,
+		ExpiresAt:      req.ExpiresAt,
+		MaxClicks:      req.MaxClicks,
+		RedirectType:   req.RedirectType,
+		ForwardQuery:   req.ForwardQuery,
+		Interstitial:   req.Interstitial,
+		Title:          req.Title,
+		Note:           req.Note,
+		Tags:           req.Tags.Normalize(),
+		PasswordHash:   passwordHash,
 	}
 
-	if err := linkQuery.Create(link); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to create link",
+	// Return the token's existing link for the destination instead of a new
+	// code, unless a custom code was asked for
+	reuse := apiToken.DedupeLinks
+	if req.Dedupe != nil {
+		reuse = *req.Dedupe
+	}
+	reuse = reuse && req.Code == "" && req.Password == ""
+
+	existing, err := linkQuery.CreateWithinQuota(link, reuse, linkQuotas(apiToken, time.Now().UTC())...)
+	if err != nil {
+		var quotaErr *queries.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			return nil, false, quotaErr
+		}
+		return nil, false, problem.Internal("Failed to create link", err)
+	}
+	if existing != nil {
+		return existing, true, nil
+	}
+
+	link.Domain = apiToken.Domain
+
+	// Drop a cached "not found" for the code
+	linkcache.Invalidate(link.DomainID, link.Code)
+
+	return link, false, nil
+}
+
+// linkQuotas returns the token's daily and monthly link creation quotas, in UTC
+func linkQuotas(token *models.APIToken, now time.Time) []queries.LinkQuota {
+	var quotas []queries.LinkQuota
+	if token.DailyLinkQuota > 0 {
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		quotas = append(quotas, queries.LinkQuota{
+			Name:  "Daily",
+			Limit: token.DailyLinkQuota,
+			Since: day,
+			Until: day.AddDate(0, 0, 1),
+		})
+	}
+	if token.MonthlyLinkQuota > 0 {
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		quotas = append(quotas, queries.LinkQuota{
+			Name:  "Monthly",
+			Limit: token.MonthlyLinkQuota,
+			Since: month,
+			Until: month.AddDate(0, 1, 0),
 		})
 	}
+	return quotas
+}
 
-	return c.Status(201).JSON(fiber.Map{
+// tokenLinkDomain returns the domain a link of an API token is looked up on:
+// ?domain_id= if given (0 for the default domain), else the token's domain
+func tokenLinkDomain(c fiber.Ctx, token *models.APIToken) *uint {
+	if c.Query("domain_id") != "" {
+		id := fiber.Query[uint](c, "domain_id", 0)
+		return &id
+	}
+	return token.DomainID
+}
+
+// shortLinkResponse builds the public representation of a link for API token holders
+func shortLinkResponse(c fiber.Ctx, link *models.Link) fiber.Map {
+	return fiber.Map{
+		"code":               link.Code,
+		"original_url":       link.OriginalURL,
+		"short_url":          shortURL(c.BaseURL(), link),
+		"title":              link.Title,
+		"note":               link.Note,
+		"tags":               link.Tags,
+		"expires_at":         link.ExpiresAt,
+		"max_clicks":         link.MaxClicks,
+		"redirect_type":      link.RedirectType,
+		"forward_query":      link.ForwardQuery,
+		"interstitial":       link.Interstitial,
+		"click_count":        link.ClickCount,
+		"password_protected": link.IsProtected(),
+		"created_at":         link.CreatedAt,
+		"updated_at":         link.UpdatedAt,
+	}
+}
+
+// shortURL returns the short URL of a link on its domain. Links on the
+// default domain use baseURL, the root URL of the current request.
+func shortURL(baseURL string, link *models.Link) string {
+	if link.Domain != nil {
+		baseURL = link.Domain.BaseURL()
+	}
+	return baseURL + "/" + link.Code
+}
+
+// ListShortLinks handles GET /api/v1/links, filtered by ?search and ?tag and
+// ordered by ?sort
+func ListShortLinks(c fiber.Ctx) error {
+	limit := fiber.Query[int](c, "limit", 50)
+	offset := fiber.Query[int](c, "offset", 0)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	filter := queries.LinkFilter{
+		Search: strings.TrimSpace(fiber.Query[string](c, "search", "")),
+		Tag:    strings.TrimSpace(fiber.Query[string](c, "tag", "")),
+		Sort:   fiber.Query[string](c, "sort", queries.DefaultLinkSort),
+	}
+	if !queries.IsValidLinkSort(filter.Sort) {
+		return invalidField("sort", "oneof", "sort must be one of: "+strings.Join(queries.LinkSorts, ", ")+", optionally prefixed with -")
+	}
+
+	apiToken := c.Locals("api_token").(*models.APIToken)
+
+	db := database.GetDB()
+	linkQuery := &queries.LinkQuery{DB: db}
+
+	links, total, err := linkQuery.ListByToken(apiToken.ID, filter, limit, offset)
+	if err != nil {
+		return problem.Internal("Failed to list links", err)
+	}
+
+	data := make([]fiber.Map, len(links))
+	for i := range links {
+		data[i] = shortLinkResponse(c, &links[i])
+	}
+
+	return c.JSON(fiber.Map{
 		"success": true,
-		"data": fiber.Map{
-			"code":         link.Code,
-			"original_url": link.OriginalURL,
-			"short_url":    c.BaseURL() + "/" + link.Code,
-		},
+		"data":    data,
+		"total":   total,
 	})
 }
 
-// Redirect handles GET /:code
+// GetShortLink handles GET /api/v1/links/:code
+func GetShortLink(c fiber.Ctx) error {
+	code := c.Params("code")
+	apiToken := c.Locals("api_token").(*models.APIToken)
+
+	db := database.GetDB()
+	linkQuery := &queries.LinkQuery{DB: db}
+
+	link, err := linkQuery.GetByCodeAndToken(tokenLinkDomain(c, apiToken), code, apiToken.ID)
+	if err != nil {
+		return problem.New(404, problem.TypeLinkNotFound, "Link not found")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    shortLinkResponse(c, link),
+	})
+}
+
+// UpdateShortLink handles PUT /api/v1/links/:code
+func UpdateShortLink(c fiber.Ctx) error {
+	code := c.Params("code")
+
+	var req UpdateLinkRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	if err := validateLinkLimits(req.ExpiresAt.Value, req.MaxClicks.Value); err != nil {
+		return err
+	}
+
+	if req.OriginalURL != "" {
+		if err := screenDestination(c, req.OriginalURL); err != nil {
+			return err
+		}
+	}
+
+	apiToken := c.Locals("api_token").(*models.APIToken)
+
+	db := database.GetDB()
+	linkQuery := &queries.LinkQuery{DB: db}
+
+	// Make sure the link belongs to the calling token
+	existing, err := linkQuery.GetByCodeAndToken(tokenLinkDomain(c, apiToken), code, apiToken.ID)
+	if err != nil {
+		return problem.New(404, problem.TypeLinkNotFound, "Link not found")
+	}
+
+	link := &models.Link{
+		OriginalURL: req.OriginalURL,
+	}
+	details := queries.LinkDetails{
+		ExpiresAt:    req.ExpiresAt,
+		MaxClicks:    req.MaxClicks,
+		Title:        req.Title,
+		Note:         req.Note,
+		Tags:         req.Tags.Normalize(),
+		RedirectType: req.RedirectType,
+		ForwardQuery: req.ForwardQuery,
+		Interstitial: req.Interstitial,
+		Password:     req.Password,
+	}
+	if err := linkQuery.UpdateWithDetails(existing.ID, link, details); err != nil {
+		return problem.Internal("Failed to update link", err)
+	}
+
+	linkcache.Invalidate(existing.DomainID, code)
+
+	updatedLink, err := linkQuery.GetByCodeAndToken(existing.DomainID, code, apiToken.ID)
+	if err != nil {
+		return problem.Internal("Failed to get updated link", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    shortLinkResponse(c, updatedLink),
+	})
+}
+
+// DeleteShortLink handles DELETE /api/v1/links/:code
+func DeleteShortLink(c fiber.Ctx) error {
+	code := c.Params("code")
+	apiToken := c.Locals("api_token").(*models.APIToken)
+
+	db := database.GetDB()
+	linkQuery := &queries.LinkQuery{DB: db}
+
+	// Make sure the link belongs to the calling token
+	link, err := linkQuery.GetByCodeAndToken(tokenLinkDomain(c, apiToken), code, apiToken.ID)
+	if err != nil {
+		return problem.New(404, problem.TypeLinkNotFound, "Link not found")
+	}
+
+	if err := linkQuery.Delete(link.ID); err != nil {
+		return problem.Internal("Failed to delete link", err)
+	}
+
+	linkcache.Invalidate(link.DomainID, code)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Link deleted successfully",
+	})
+}
+
+// GetShortLinkStats handles GET /api/v1/links/:code/stats
+func GetShortLinkStats(c fiber.Ctx) error {
+	code := c.Params("code")
+	apiToken := c.Locals("api_token").(*models.APIToken)
+
+	db := database.GetDB()
+	linkQuery := &queries.LinkQuery{DB: db}
+
+	link, err := linkQuery.GetByCodeAndToken(tokenLinkDomain(c, apiToken), code, apiToken.ID)
+	if err != nil {
+		return problem.New(404, problem.TypeLinkNotFound, "Link not found")
+	}
+
+	return sendLinkStats(c, link)
+}
+
+// Redirect handles GET /:code and GET /:code/*. The code is looked up on the
+// domain of the Host header. The path after the code is appended to the
+// destination or fills its placeholders, see utils.ExpandDestination. Links
+// with Interstitial set show the preview page with a countdown instead.
 func Redirect(c fiber.Ctx) error {
 	code := c.Params("code")
 
 	db := database.GetDB()
 	linkQuery := &queries.LinkQuery{DB: db}
 
-	link, err := linkQuery.GetByCode(code)
+	domain, err := requestDomain(c)
+	if err != nil {
+		return c.Status(500).SendString("Failed to resolve link")
+	}
+
+	link, err := linkcache.Get(domainID(domain), code, linkQuery.GetByCode)
 	if err != nil {
 		return c.Status(404).SendString("Link not found")
 	}
 
-	// Only publish to RabbitMQ if link was generated via API
-	if link.IsAPIGenerated && link.APIToken != nil {
-		// Copy values before goroutine (Fiber context reuse warning)
-		ip := c.IP()
-		userAgent := c.Get("User-Agent")
-		codeCopy := code
-		originalURL := link.OriginalURL
-		apiTokenCopy := link.APIToken
+	if reason := linkGoneReason(link); reason != "" {
+		return renderGone(c, reason)
+	}
+
+	// Protected links ask for the password first, see UnlockLink
+	if link.IsProtected() && !isUnlocked(c, link) {
+		return renderUnlock(c, fiber.StatusUnauthorized, "")
+	}
+
+	// Links with a click limit are counted synchronously so the limit is exact;
+	// everything else is counted together with the click record.
+	counted := false
+	if link.MaxClicks != nil {
+		ok, err := linkQuery.ConsumeClick(link.ID)
+		if err != nil {
+			return c.Status(500).SendString("Failed to resolve link")
+		}
+		if !ok {
+			return renderGone(c, "exhausted")
+		}
+		counted = true
+	}
+
+	// Copy values before goroutine (Fiber context reuse warning)
+	ip := c.IP()
+	userAgent := strings.Clone(c.Get("User-Agent"))
+
+	// Record click for every redirect
+	click := &models.Click{
+		LinkID:    link.ID,
+		Code:      link.Code,
+		ClickedAt: time.Now().UTC(),
+		Referrer:  strings.Clone(c.Get("Referer")),
+		UserAgent: userAgent,
+		IPHash:    utils.HashIP(config.Secrets.MasterKey, ip),
+	}
+
+	// Only emit click events to the token's sink if link was generated via API
+	var event *models.OutboxEvent
+	if link.IsAPIGenerated && link.APIToken != nil && queue.AllowPublish(link.APIToken, ip, userAgent, globalRateLimiter) {
+		event, err = queue.NewOutboxEvent(link.APIToken, link.ID, queue.NewClickEvent(link.Code, link.OriginalURL, ip, userAgent))
+		if err != nil {
+			log.Printf("Failed to build click event for %s: %v", link.Code, err)
+		}
+	}
+
+	if event != nil {
+		// Written before redirecting so a click event is durable once the
+		// visitor is sent on; the outbox dispatcher delivers it with retries
+		recordClick(click, event, counted)
+	} else {
+		go recordClick(click, nil, counted)
+	}
 
-		// Publish click event asynchronously with rate limiting
-		go func() {
-			queue.PublishClickEvent(apiTokenCopy, codeCopy, originalURL, ip, userAgent, globalRateLimiter)
-		}()
+	// The click is counted when the interstitial is shown, it sends the
+	// visitor on by itself after the countdown
+	if link.Interstitial {
+		return renderPreview(c, link, config.Preview.Countdown)
 	}
 
-	return c.Redirect().To(link.OriginalURL)
+	return redirectTo(c, link)
+}
+
+// requestDomain returns the registered domain of the request's host, or nil
+// for the default domain
+func requestDomain(c fiber.Ctx) (*models.Domain, error) {
+	domainQuery := &queries.DomainQuery{DB: database.GetDB()}
+	return linkcache.Domain(c.Hostname(), domainQuery.GetByHost)
+}
+
+// domainID returns the ID of a domain, nil for the default domain
+func domainID(domain *models.Domain) *uint {
+	if domain == nil {
+		return nil
+	}
+	return &domain.ID
+}
+
+// redirectTo sends the visitor on to the expanded destination with the
+// link's redirect type. Permanent
+// redirects may be cached by browsers and CDNs, but no longer than the link
+// lives; temporary ones, links with a click limit and password protected
+// links are never cached so every click reaches us.
+func redirectTo(c fiber.Ctx, link *models.Link) error {
+	status := link.RedirectType
+	if status == 0 {
+		status = config.Redirect.DefaultType
+	}
+	c.Set(fiber.HeaderCacheControl, redirectCacheControl(status, link, time.Now()))
+	return c.Redirect().Status(status).To(expandedDestination(c, link))
+}
+
+// expandedDestination returns where the requested short URL goes, with the
+// path after the code and, if the link forwards it, the query string
+func expandedDestination(c fiber.Ctx, link *models.Link) string {
+	var query url.Values
+	if link.ForwardQuery {
+		query, _ = url.ParseQuery(string(c.Request().URI().QueryString()))
+	}
+	return utils.ExpandDestination(link.OriginalURL, c.Params("*"), query)
+}
+
+// redirectCacheControl returns the Cache-Control header of a redirect
+func redirectCacheControl(status int, link *models.Link, now time.Time) string {
+	const noStore = "private, no-store"
+	permanent := status == fiber.StatusMovedPermanently || status == fiber.StatusPermanentRedirect
+	if !permanent || link.MaxClicks != nil || link.IsProtected() {
+		return noStore
+	}
+
+	maxAge := config.Redirect.PermanentMaxAge
+	if link.ExpiresAt != nil && link.ExpiresAt.Sub(now) < maxAge {
+		maxAge = link.ExpiresAt.Sub(now)
+	}
+	if maxAge < time.Second {
+		return noStore
+	}
+	return "public, max-age=" + strconv.Itoa(int(maxAge/time.Second))
+}
+
+// recordClick persists a click event together with its optional outbox event.
+// When counted is false the link's click counter is incremented as well.
+func recordClick(click *models.Click, event *models.OutboxEvent, counted bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	db := database.GetDB()
+	clickQuery := &queries.ClickQuery{DB: db}
+	if err := clickQuery.Create(ctx, click, event); err != nil {
+		log.Printf("Failed to record click for %s: %v", click.Code, err)
+	}
+
+	if !counted {
+		linkQuery := &queries.LinkQuery{DB: db}
+		if err := linkQuery.IncrementClicks(ctx, click.LinkID); err != nil {
+			log.Printf("Failed to increment click count for %s: %v", click.Code, err)
+		}
+	}
 }
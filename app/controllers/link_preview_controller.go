@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"boilerplate/app/models"
+	"boilerplate/app/queries"
+	"boilerplate/platform/database"
+	"boilerplate/platform/preview"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// PreviewLink handles GET /:code+, a page showing where a short link goes
+// before following it: the destination with its title and favicon, when the
+// link was created and how often it was clicked. Viewing it is not a click.
+func PreviewLink(c fiber.Ctx) error {
+	code := c.Params("code")
+
+	db := database.GetDB()
+	linkQuery := &queries.LinkQuery{DB: db}
+
+	domain, err := requestDomain(c)
+	if err != nil {
+		return c.Status(500).SendString("Failed to resolve link")
+	}
+
+	// Not from the redirect cache, so the click count is current
+	link, err := linkQuery.GetByCode(domainID(domain), code)
+	if err != nil {
+		return c.Status(404).SendString("Link not found")
+	}
+
+	if reason := linkGoneReason(link); reason != "" {
+		return renderGone(c, reason)
+	}
+
+	// The destination of a protected link is only shown after unlocking it
+	if link.IsProtected() && !isUnlocked(c, link) {
+		return renderUnlock(c, fiber.StatusUnauthorized, "")
+	}
+
+	return renderPreview(c, link, 0)
+}
+
+// renderPreview renders the preview page of a link. With a countdown the
+// page is an interstitial that sends the visitor on by itself once it ends.
+// Interstitials are part of the redirect, so they don't wait for the
+// destination to be fetched and only show what is cached.
+func renderPreview(c fiber.Ctx, link *models.Link, countdown time.Duration) error {
+	destination := expandedDestination(c, link)
+	var page *preview.Page
+	if countdown > 0 {
+		page = preview.Cached(destination)
+	} else {
+		page = preview.Fetch(destination)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.Render("preview", fiber.Map{
+		"Title":       "Link preview",
+		"ShortURL":    shortURL(c.BaseURL(), link),
+		"Destination": destination,
+		"PageTitle":   page.Title,
+		"Favicon":     page.Favicon,
+		"CreatedAt":   link.CreatedAt,
+		"ClickCount":  link.ClickCount,
+		"Countdown":   int(countdown / time.Second),
+	})
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"boilerplate/app/models"
+	"boilerplate/app/queries"
+	"boilerplate/config"
+	"boilerplate/pkg/ratelimiter"
+	"boilerplate/pkg/utils"
+	"boilerplate/platform/database"
+	"boilerplate/platform/linkcache"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// unlockCookie prefixes the cookie holding "<expiry unix>.<signature>" for
+// one protected link. Every unlocked link has its own cookie, named after
+// its ID, on path "/" so it is also sent to the preview page (/:code+).
+const unlockCookie = "link_unlock_"
+
+// UnlockLink handles POST /:code, POST /:code/* and POST /:code+, the
+// password form of a protected link. Wrong passwords are rate limited per
+// client IP; on success the link is unlocked for config.Redirect.UnlockTTL
+// and the visitor is sent back to the short URL.
+func UnlockLink(c fiber.Ctx) error {
+	code := c.Params("code")
+
+	db := database.GetDB()
+	linkQuery := &queries.LinkQuery{DB: db}
+
+	domain, err := requestDomain(c)
+	if err != nil {
+		return c.Status(500).SendString("Failed to resolve link")
+	}
+
+	link, err := linkcache.Get(domainID(domain), code, linkQuery.GetByCode)
+	if err != nil {
+		return c.Status(404).SendString("Link not found")
+	}
+
+	if reason := linkGoneReason(link); reason != "" {
+		return renderGone(c, reason)
+	}
+	if !link.IsProtected() {
+		return c.Redirect().Status(fiber.StatusSeeOther).To(c.OriginalURL())
+	}
+
+	// Every attempt takes a token before the password is checked, so
+	// concurrent guesses can't all get through; a correct password gives it
+	// back, so a client can unlock any number of links it knows passwords of
+	key := "unlock:ip:" + c.IP()
+	limit := ratelimiter.Limit{
+		Requests: config.RateLimit.UnlockRequests,
+		Period:   config.RateLimit.UnlockPeriod,
+	}
+	limited := limit.Requests > 0 && limit.Period > 0
+	if limited {
+		if result := globalRateLimiter.Take(key, limit); !result.Allowed {
+			minutes := int(math.Ceil(result.RetryAfter.Minutes()))
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+			return renderUnlock(c, fiber.StatusTooManyRequests, fmt.Sprintf("Too many attempts. Try again in %d minute(s).", minutes))
+		}
+	}
+
+	if err := linkQuery.ValidatePassword(link, c.FormValue("password")); err != nil {
+		log.Printf("Wrong password for link %s from %s", link.Code, c.IP())
+		return renderUnlock(c, fiber.StatusUnauthorized, "Wrong password.")
+	}
+	if limited {
+		globalRateLimiter.Refund(key, limit)
+	}
+
+	expires := time.Now().Add(config.Redirect.UnlockTTL)
+	c.Cookie(&fiber.Cookie{
+		Name:     unlockCookieName(link),
+		Value:    strconv.FormatInt(expires.Unix(), 10) + "." + unlockSignature(link, expires.Unix()),
+		Path:     "/",
+		Expires:  expires,
+		HTTPOnly: true,
+		Secure:   config.Session.CookieSecure,
+		SameSite: "Lax",
+	})
+
+	return c.Redirect().Status(fiber.StatusSeeOther).To(c.OriginalURL())
+}
+
+// isUnlocked reports whether the request carries a valid unlock cookie for
+// the link. Changing the password invalidates existing cookies.
+func isUnlocked(c fiber.Ctx, link *models.Link) bool {
+	expiry, signature, ok := strings.Cut(c.Cookies(unlockCookieName(link)), ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return false
+	}
+	return utils.VerifySignature(config.Secrets.MasterKey, unlockMessage(link, expires), signature)
+}
+
+func unlockCookieName(link *models.Link) string {
+	return unlockCookie + strconv.FormatUint(uint64(link.ID), 10)
+}
+
+func unlockSignature(link *models.Link, expires int64) string {
+	return utils.Sign(config.Secrets.MasterKey, unlockMessage(link, expires))
+}
+
+// unlockMessage is what an unlock cookie signs; the prefix keeps the
+// signature from being valid for any other use of the master key
+func unlockMessage(link *models.Link, expires int64) string {
+	return fmt.Sprintf("link-unlock:%d:%d:%s", link.ID, expires, link.PasswordHash)
+}
+
+// renderUnlock renders the password form of a protected link
+func renderUnlock(c fiber.Ctx, status int, message string) error {
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.Status(status).Render("unlock", fiber.Map{
+		"Title": "Password required",
+		"Error": message,
+	})
+}
@@ -0,0 +1,27 @@
+package controllers
+
+import (
+	"boilerplate/pkg/problem"
+	"boilerplate/pkg/validation"
+)
+
+// invalidBody turns a failed c.Bind().Body into a 400 problem. Validation
+// failures list every invalid field under "errors".
+func invalidBody(err error) error {
+	fields, ok := validation.Errors(err)
+	if !ok {
+		return problem.New(400, problem.TypeInvalidBody, "Invalid request body").Wrap(err)
+	}
+
+	return problem.New(400, problem.TypeValidationFailed, fields[0].Message).With("errors", fields)
+}
+
+// invalidField reports a single invalid field in the same shape, for checks
+// that can't be expressed as validate tags
+func invalidField(field, rule, message string) error {
+	return problem.New(400, problem.TypeValidationFailed, message).With("errors", []validation.FieldError{{
+		Field:   field,
+		Rule:    rule,
+		Message: message,
+	}})
+}
@@ -3,16 +3,21 @@ package controllers
 import (
 	"boilerplate/app/models"
 	"boilerplate/app/queries"
-	"boilerplate/platform/database"
+	"boilerplate/pkg/problem"
 	"boilerplate/pkg/utils"
+	"boilerplate/platform/database"
+	"boilerplate/platform/linkcache"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 )
 
 // ShortenRequest request struct for web UI shorten
 type ShortenRequest struct {
-	OriginalURL string `json:"original_url" validate:"required,url"`
-	Code        string `json:"code,omitempty" validate:"omitempty,min=4,max=20"`
+	OriginalURL string     `json:"original_url" validate:"required,url"`
+	Code        string     `json:"code,omitempty" validate:"omitempty,shortcode"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	MaxClicks   *int64     `json:"max_clicks,omitempty" validate:"omitempty,min=1"`
 }
 
 // IndexPage handles GET /
@@ -26,27 +31,35 @@ func IndexPage(c fiber.Ctx) error {
 func ShortenURL(c fiber.Ctx) error {
 	var req ShortenRequest
 	if err := c.Bind().Body(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"error":   "Invalid request body",
-		})
+		return invalidBody(err)
+	}
+
+	if err := validateLinkLimits(req.ExpiresAt, req.MaxClicks); err != nil {
+		return err
+	}
+
+	if err := screenDestination(c, req.OriginalURL); err != nil {
+		return err
 	}
 
 	db := database.GetDB()
 	linkQuery := &queries.LinkQuery{DB: db}
 
+	// Links are created on the domain the page was served from
+	domain, err := requestDomain(c)
+	if err != nil {
+		return problem.Internal("Failed to resolve domain", err)
+	}
+
 	// Generate code if not provided
 	code := req.Code
 	if code == "" {
 		code = utils.GenerateShortCode()
 		// Ensure uniqueness
 		for {
-			exists, err := linkQuery.Exists(code)
+			exists, err := linkQuery.Exists(domainID(domain), code)
 			if err != nil {
-				return c.Status(500).JSON(fiber.Map{
-					"success": false,
-					"error":   "Failed to check code uniqueness",
-				})
+				return problem.Internal("Failed to check code uniqueness", err)
 			}
 			if !exists {
 				break
@@ -54,50 +67,43 @@ func ShortenURL(c fiber.Ctx) error {
 			code = utils.GenerateShortCode()
 		}
 	} else {
-		// Validate custom code
-		if !utils.ValidateCode(code) {
-			return c.Status(400).JSON(fiber.Map{
-				"success": false,
-				"error":   "Invalid code format. Use 4-20 alphanumeric characters, hyphens, or underscores",
-			})
-		}
-
 		// Check if code exists
-		exists, err := linkQuery.Exists(code)
+		exists, err := linkQuery.Exists(domainID(domain), code)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"success": false,
-				"error":   "Failed to check code",
-			})
+			return problem.Internal("Failed to check code", err)
 		}
 		if exists {
-			return c.Status(409).JSON(fiber.Map{
-				"success": false,
-				"error":   "This custom code is already taken. Please choose another one.",
-			})
+			return problem.New(409, problem.TypeCodeTaken, "This custom code is already taken. Please choose another one.")
 		}
 	}
 
 	// Create link (not from API, so IsAPIGenerated = false)
 	link := &models.Link{
 		Code:            code,
+		DomainID:        domainID(domain),
 		OriginalURL:     req.OriginalURL,
 		IsAPIGenerated:  false,
+		ExpiresAt:       req.ExpiresAt,
+		MaxClicks:       req.MaxClicks,
 	}
 
 	if err := linkQuery.Create(link); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to create link",
-		})
+		return problem.Internal("Failed to create link", err)
 	}
 
+	link.Domain = domain
+
+	// Drop a cached "not found" for the code
+	linkcache.Invalidate(link.DomainID, link.Code)
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"data": fiber.Map{
 			"code":         link.Code,
 			"original_url": link.OriginalURL,
-			"short_url":    c.BaseURL() + "/" + link.Code,
+			"short_url":    shortURL(c.BaseURL(), link),
+			"expires_at":   link.ExpiresAt,
+			"max_clicks":   link.MaxClicks,
 		},
 	})
 }
@@ -1,8 +1,14 @@
 package middleware
 
 import (
+	"boilerplate/app/models"
 	"boilerplate/app/queries"
+	"boilerplate/pkg/problem"
+	"boilerplate/pkg/utils"
 	"boilerplate/platform/database"
+	"crypto/subtle"
+	"log"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 )
@@ -11,19 +17,42 @@ import (
 func RequireAPIToken(c fiber.Ctx) error {
 	token := c.Get("X-API-Token")
 	if token == "" {
-		return c.Status(401).JSON(fiber.Map{
-			"error": "API token required",
-		})
+		return problem.New(401, problem.TypeTokenMissing, "API token required")
 	}
 
 	db := database.GetDB()
 	tokenQuery := &queries.APITokenQuery{DB: db}
 
-	apiToken, err := tokenQuery.GetByToken(token)
+	// Tokens are stored hashed: find candidates by prefix, then compare hashes
+	candidates, err := tokenQuery.ListByPrefix(utils.TokenPrefix(token))
 	if err != nil {
-		return c.Status(401).JSON(fiber.Map{
-			"error": "Invalid API token",
-		})
+		return problem.Internal("Failed to validate API token", err)
+	}
+
+	tokenHash := []byte(utils.HashToken(token))
+	var apiToken *models.APIToken
+	for i := range candidates {
+		if subtle.ConstantTimeCompare(tokenHash, []byte(candidates[i].TokenHash)) == 1 {
+			apiToken = &candidates[i]
+		}
+	}
+
+	if apiToken == nil {
+		return problem.New(401, problem.TypeTokenInvalid, "Invalid API token")
+	}
+
+	if apiToken.IsRevoked() {
+		return problem.New(401, problem.TypeTokenRevoked, "API token has been revoked")
+	}
+	if apiToken.IsExpired() {
+		return problem.New(401, problem.TypeTokenExpired, "API token has expired")
+	}
+
+	now := time.Now().UTC()
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) >= touchInterval || apiToken.LastUsedIP != c.IP() {
+		if err := tokenQuery.Touch(apiToken.ID, now, c.IP()); err != nil {
+			log.Printf("Failed to update API token %d usage: %v", apiToken.ID, err)
+		}
 	}
 
 	// Store token in locals for use in handlers
@@ -31,3 +60,24 @@ func RequireAPIToken(c fiber.Ctx) error {
 
 	return c.Next()
 }
+
+// CurrentAPIToken returns the authenticated API token set by RequireAPIToken
+func CurrentAPIToken(c fiber.Ctx) *models.APIToken {
+	token, _ := c.Locals("api_token").(*models.APIToken)
+	return token
+}
+
+// RequireScope middleware allows the request only if the calling API token
+// was granted the scope. Must run after RequireAPIToken.
+func RequireScope(scope string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		token := CurrentAPIToken(c)
+		if token == nil {
+			return problem.New(401, problem.TypeTokenMissing, "API token required")
+		}
+		if !token.Scopes.Has(scope) {
+			return problem.New(403, problem.TypeInsufficientScope, "API token is missing the "+scope+" scope")
+		}
+		return c.Next()
+	}
+}
@@ -1,22 +1,93 @@
 package middleware
 
 import (
+	"boilerplate/app/models"
+	"boilerplate/app/queries"
+	"boilerplate/config"
+	"boilerplate/pkg/problem"
+	"boilerplate/pkg/rbac"
+	"boilerplate/pkg/utils"
+	"boilerplate/platform/database"
+	"log"
+	"strings"
+	"time"
+
 	"github.com/gofiber/fiber/v3"
 )
 
 const (
-	adminSessionKey  = "admin_authenticated"
-	adminUsernameKey = "admin_username"
+	// AdminSessionCookie is the name of the cookie holding the admin session ID
+	AdminSessionCookie = "admin_session"
+
+	// touchInterval limits how often a session's last activity is written
+	touchInterval = time.Minute
 )
 
-// RequireAdminAuth middleware checks if user is authenticated as admin
+// RequireAdminAuth middleware checks that the request carries a valid admin session
+// and stores the session and its AdminUser in c.Locals("admin_session") / c.Locals("admin_user")
 func RequireAdminAuth(c fiber.Ctx) error {
-	// Check session cookie
-	authenticated := c.Cookies(adminSessionKey)
+	sessionID := c.Cookies(AdminSessionCookie)
+	if sessionID == "" {
+		return unauthorized(c)
+	}
 
-	if authenticated == "" || authenticated != "true" {
-		return c.Redirect().To("/admin/login")
+	db := database.GetDB()
+	sessionQuery := &queries.AdminSessionQuery{DB: db}
+
+	session, err := sessionQuery.GetByTokenHash(utils.HashToken(sessionID))
+	if err != nil || session.AdminUser == nil {
+		return unauthorized(c)
 	}
 
+	now := time.Now().UTC()
+	if !now.Before(session.ExpiresAt) || now.Sub(session.LastSeenAt) >= config.Session.IdleTimeout {
+		if err := sessionQuery.Delete(session.ID); err != nil {
+			log.Printf("Failed to delete expired session %d: %v", session.ID, err)
+		}
+		return unauthorized(c)
+	}
+
+	if now.Sub(session.LastSeenAt) >= touchInterval {
+		if err := sessionQuery.Touch(session.ID, now); err != nil {
+			log.Printf("Failed to update session %d activity: %v", session.ID, err)
+		}
+	}
+
+	// Store session and user in locals for use in handlers
+	c.Locals("admin_session", session)
+	c.Locals("admin_user", session.AdminUser)
+
 	return c.Next()
 }
+
+// CurrentAdmin returns the authenticated admin user set by RequireAdminAuth
+func CurrentAdmin(c fiber.Ctx) *models.AdminUser {
+	user, _ := c.Locals("admin_user").(*models.AdminUser)
+	return user
+}
+
+// RequirePermission middleware allows the request only if the current admin's
+// role grants the permission. Must run after RequireAdminAuth.
+func RequirePermission(permission string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		user := CurrentAdmin(c)
+		if user == nil {
+			return unauthorized(c)
+		}
+		if !rbac.Can(user.Role, permission) {
+			if strings.HasPrefix(c.Path(), "/api/") {
+				return problem.New(403, problem.TypeForbidden, "You do not have permission to perform this action")
+			}
+			return c.Status(403).SendString("Forbidden")
+		}
+		return c.Next()
+	}
+}
+
+// unauthorized rejects API calls with 401 and sends browsers to the login page
+func unauthorized(c fiber.Ctx) error {
+	if strings.HasPrefix(c.Path(), "/api/") {
+		return problem.New(401, problem.TypeUnauthorized, "Authentication required")
+	}
+	return c.Redirect().To("/admin/login")
+}
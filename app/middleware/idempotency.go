@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"boilerplate/app/models"
+	"boilerplate/app/queries"
+	"boilerplate/pkg/problem"
+	"boilerplate/platform/database"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+const (
+	// idempotencyKeyTTL is how long a response is replayed for its key
+	idempotencyKeyTTL = 24 * time.Hour
+	// idempotencyKeyLease is how long a key stays reserved while its first
+	// request runs. It outlasts any request, and frees the key of a process
+	// that crashed mid-request so the client can retry with it.
+	idempotencyKeyLease = 2 * time.Minute
+	// maxIdempotencyKeyLength matches the key column
+	maxIdempotencyKeyLength = 255
+)
+
+// Idempotency middleware makes retries of a request with the same
+// Idempotency-Key header safe. Keys are scoped per API token: the first
+// successful response is stored for 24h and replayed for later requests with
+// the key, a different payload with the key gets 409. Failed requests don't
+// keep the key, so they can be retried, and a key whose request never
+// finished is free again after idempotencyKeyLease. Must run after
+// RequireAPIToken.
+func Idempotency() fiber.Handler {
+	go purgeIdempotencyKeys()
+
+	return func(c fiber.Ctx) error {
+		key := c.Get("Idempotency-Key")
+		token := CurrentAPIToken(c)
+		if key == "" || token == nil {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return problem.New(400, problem.TypeInvalidIdempotencyKey, "Idempotency-Key must be at most 255 characters")
+		}
+
+		db := database.GetDB()
+		keyQuery := &queries.IdempotencyKeyQuery{DB: db}
+
+		record := &models.IdempotencyKey{
+			APITokenID:  token.ID,
+			Key:         key,
+			RequestHash: requestHash(c),
+			ExpiresAt:   time.Now().UTC().Add(idempotencyKeyLease),
+		}
+		reserved, err := keyQuery.Reserve(record)
+		if err != nil {
+			return problem.Internal("Failed to store idempotency key", err)
+		}
+		if !reserved {
+			return replay(c, keyQuery, record)
+		}
+
+		err = c.Next()
+		status := c.Response().StatusCode()
+		if err != nil || status < 200 || status >= 300 {
+			if releaseErr := keyQuery.Release(record.ID); releaseErr != nil {
+				log.Printf("Failed to release idempotency key %d: %v", record.ID, releaseErr)
+			}
+			return err
+		}
+
+		response := append([]byte(nil), c.Response().Body()...)
+		contentType := string(c.Response().Header.ContentType())
+		expiresAt := time.Now().UTC().Add(idempotencyKeyTTL)
+		if err := keyQuery.Complete(record.ID, status, contentType, response, expiresAt); err != nil {
+			// The link exists either way; a retry will be rejected as in progress
+			// until the lease runs out
+			log.Printf("Failed to store response for idempotency key %d: %v", record.ID, err)
+		}
+		return nil
+	}
+}
+
+// replay answers a request whose key is already taken with the stored response
+func replay(c fiber.Ctx, keyQuery *queries.IdempotencyKeyQuery, request *models.IdempotencyKey) error {
+	stored, err := keyQuery.Get(request.APITokenID, request.Key)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Released or expired in the meantime
+		return problem.New(409, problem.TypeIdempotencyKeyInUse, "A request with this Idempotency-Key is in progress, retry it")
+	}
+	if err != nil {
+		return problem.Internal("Failed to load idempotency key", err)
+	}
+
+	if stored.RequestHash != request.RequestHash {
+		return problem.New(409, problem.TypeIdempotencyKeyReused, "Idempotency-Key was already used for a different request")
+	}
+	if stored.IsPending() {
+		return problem.New(409, problem.TypeIdempotencyKeyInUse, "A request with this Idempotency-Key is in progress, retry it")
+	}
+
+	c.Set("Idempotent-Replayed", "true")
+	c.Set(fiber.HeaderContentType, stored.ContentType)
+	return c.Status(stored.StatusCode).Send(stored.Response)
+}
+
+// requestHash fingerprints the method, path and body of a request
+func requestHash(c fiber.Ctx) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Method() + " " + c.Path() + "\n"))
+	hash.Write(c.Body())
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// purgeIdempotencyKeys periodically removes expired keys
+func purgeIdempotencyKeys() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		keyQuery := &queries.IdempotencyKeyQuery{DB: database.GetDB()}
+		if err := keyQuery.DeleteExpired(time.Now().UTC()); err != nil {
+			log.Printf("Failed to purge expired idempotency keys: %v", err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"boilerplate/pkg/problem"
+	"boilerplate/pkg/ratelimiter"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// RateLimitByIP middleware throttles requests per client IP with a token
+// bucket. name separates the buckets of different endpoints.
+func RateLimitByIP(limiter *ratelimiter.RateLimiter, name string, limit ratelimiter.Limit) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return rateLimit(c, limiter, name+":ip:"+c.IP(), limit)
+	}
+}
+
+// RateLimitByToken middleware throttles requests per API token, using the
+// token's own requests-per-minute when set and defaultLimit otherwise.
+// Must run after RequireAPIToken.
+func RateLimitByToken(limiter *ratelimiter.RateLimiter, defaultLimit ratelimiter.Limit) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		token := CurrentAPIToken(c)
+		if token == nil {
+			return c.Next()
+		}
+
+		limit := defaultLimit
+		if token.RequestsPerMinute > 0 {
+			limit = ratelimiter.Limit{Requests: token.RequestsPerMinute, Period: time.Minute}
+		}
+		return rateLimit(c, limiter, "api:token:"+strconv.FormatUint(uint64(token.ID), 10), limit)
+	}
+}
+
+// rateLimit takes a token for key; a limit of 0 requests disables throttling
+func rateLimit(c fiber.Ctx, limiter *ratelimiter.RateLimiter, key string, limit ratelimiter.Limit) error {
+	if limit.Requests <= 0 || limit.Period <= 0 {
+		return c.Next()
+	}
+	result := limiter.Take(key, limit)
+	SetRateLimitHeaders(c, result.Limit, result.Remaining, result.Reset)
+	if !result.Allowed {
+		return TooManyRequests(c, result.RetryAfter, problem.TypeRateLimited, "Too many requests")
+	}
+	return c.Next()
+}
+
+// SetRateLimitHeaders sets the X-RateLimit-* headers. Reset is the number of
+// seconds until the limit is fully available again.
+func SetRateLimitHeaders(c fiber.Ctx, limit, remaining int, reset time.Duration) {
+	c.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	c.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+}
+
+// TooManyRequests sets the Retry-After header and returns a 429 problem of
+// the given type, with retry_after in seconds
+func TooManyRequests(c fiber.Ctx, retryAfter time.Duration, typ, message string) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retrySeconds(retryAfter)))
+	return RetryLater(retryAfter, typ, message)
+}
+
+// RetryLater returns the 429 problem of TooManyRequests without setting any
+// headers, for results that are part of a larger response
+func RetryLater(retryAfter time.Duration, typ, message string) *problem.Problem {
+	seconds := retrySeconds(retryAfter)
+	return problem.New(fiber.StatusTooManyRequests, typ, message+", retry in "+strconv.Itoa(seconds)+" seconds").
+		With("retry_after", seconds)
+}
+
+// retrySeconds rounds a retry delay up to whole seconds, at least 1
+func retrySeconds(d time.Duration) int {
+	if seconds := ceilSeconds(d); seconds > 1 {
+		return seconds
+	}
+	return 1
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
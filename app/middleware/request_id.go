@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+)
+
+// maxRequestIDLength caps request IDs accepted from clients and proxies
+const maxRequestIDLength = 128
+
+// RequestID middleware assigns every request an ID with Fiber's requestid
+// middleware, read it with requestid.FromContext. The incoming X-Request-ID
+// is only kept when it looks sane (e.g. set by the load balancer); it ends up
+// in logs and responses, so anything else is replaced with a random one.
+func RequestID() fiber.Handler {
+	assign := requestid.New()
+	return func(c fiber.Ctx) error {
+		if !validRequestID(c.Get(fiber.HeaderXRequestID)) {
+			c.Request().Header.Del(fiber.HeaderXRequestID)
+		}
+		return assign(c)
+	}
+}
+
+// validRequestID accepts short IDs made of printable ASCII without spaces,
+// so they are safe to log
+func validRequestID(id string) bool {
+	if len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// AdminSession model untuk server-side admin sessions
+type AdminSession struct {
+	Base
+	TokenHash   string     `gorm:"uniqueIndex;not null;type:varchar(64)" json:"-"`
+	AdminUserID uint       `gorm:"index;not null" json:"admin_user_id"`
+	AdminUser   *AdminUser `gorm:"foreignKey:AdminUserID" json:"admin_user,omitempty"`
+	ExpiresAt   time.Time  `gorm:"index;not null" json:"expires_at"`
+	LastSeenAt  time.Time  `gorm:"not null" json:"last_seen_at"`
+	IP          string     `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent   string     `gorm:"type:text" json:"user_agent"`
+}
+
+// TableName mengembalikan nama table
+func (AdminSession) TableName() string {
+	return "admin_sessions"
+}
@@ -5,6 +5,7 @@ type AdminUser struct {
 	Base
 	Username     string `gorm:"uniqueIndex;not null" json:"username"`
 	PasswordHash string `gorm:"not null;type:varchar(255)" json:"-"`
+	Role         string `gorm:"type:varchar(20);default:admin;not null" json:"role"`
 }
 
 // TableName mengembalikan nama table
@@ -1,16 +1,50 @@
 package models
 
-// APIToken model untuk API token dengan RabbitMQ config
+import (
+	"boilerplate/pkg/scopes"
+	"boilerplate/pkg/secrets"
+	"time"
+)
+
+// APIToken model untuk API token dengan event sink config
 type APIToken struct {
 	Base
-	Token            string `gorm:"uniqueIndex;not null" json:"token"`
-	Name             string `gorm:"not null" json:"name"`
-	RabbitMQHost     string `gorm:"type:varchar(255)" json:"rabbitmq_host"`
-	RabbitMQPort     int    `gorm:"default:5672" json:"rabbitmq_port"`
-	RabbitMQUser     string `gorm:"type:varchar(255)" json:"rabbitmq_user"`
-	RabbitMQPassword string `gorm:"type:varchar(255)" json:"rabbitmq_password"`
-	RabbitMQQueue    string `gorm:"type:varchar(255)" json:"rabbitmq_queue"`
-	RateLimitSeconds int    `gorm:"default:60" json:"rate_limit_seconds"`
+	TokenHash         string                  `gorm:"uniqueIndex;not null;type:varchar(64)" json:"-"`
+	TokenPrefix       string                  `gorm:"index;not null;type:varchar(16)" json:"token_prefix"`
+	Name              string                  `gorm:"not null" json:"name"`
+	SinkType          string                  `gorm:"type:varchar(20);default:rabbitmq;not null" json:"sink_type"`
+	SinkURL           string                  `gorm:"type:text" json:"sink_url"`
+	SinkTopic         string                  `gorm:"type:varchar(255)" json:"sink_topic"`
+	SinkSecret        secrets.EncryptedString `gorm:"type:text" json:"sink_secret"`
+	RabbitMQHost      string                  `gorm:"type:varchar(255)" json:"rabbitmq_host"`
+	RabbitMQPort      int                     `gorm:"default:5672" json:"rabbitmq_port"`
+	RabbitMQUser      string                  `gorm:"type:varchar(255)" json:"rabbitmq_user"`
+	RabbitMQPassword  secrets.EncryptedString `gorm:"type:text" json:"rabbitmq_password"`
+	RabbitMQQueue     string                  `gorm:"type:varchar(255)" json:"rabbitmq_queue"`
+	RateLimitSeconds  int                     `gorm:"default:60" json:"rate_limit_seconds"`
+	RequestsPerMinute int                     `gorm:"default:0;not null" json:"requests_per_minute"`
+	DailyLinkQuota    int                     `gorm:"default:0;not null" json:"daily_link_quota"`
+	MonthlyLinkQuota  int                     `gorm:"default:0;not null" json:"monthly_link_quota"`
+	DedupeLinks       bool                    `gorm:"default:false;not null" json:"dedupe_links"`
+	DomainID          *uint                   `gorm:"index" json:"domain_id"`
+	Domain            *Domain                 `gorm:"foreignKey:DomainID" json:"domain,omitempty"`
+	Scopes            scopes.List             `gorm:"type:varchar(255);default:'links:create,links:read,links:write,stats:read';not null" json:"scopes"`
+	ExpiresAt         *time.Time              `gorm:"index" json:"expires_at"`
+	LastUsedAt        *time.Time              `json:"last_used_at"`
+	LastUsedIP        string                  `gorm:"type:varchar(45)" json:"last_used_ip"`
+	RevokedAt         *time.Time              `gorm:"index" json:"revoked_at"`
+	RevokedReason     string                  `gorm:"type:text" json:"revoked_reason"`
+	RevokedBy         string                  `gorm:"type:varchar(255)" json:"revoked_by"`
+}
+
+// IsExpired reports whether the token is past its expiry date
+func (t *APIToken) IsExpired() bool {
+	return t.ExpiresAt != nil && !t.ExpiresAt.After(time.Now())
+}
+
+// IsRevoked reports whether the token was revoked by an admin
+func (t *APIToken) IsRevoked() bool {
+	return t.RevokedAt != nil
 }
 
 // TableName mengembalikan nama table
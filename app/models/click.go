@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Click model untuk click events yang direkam setiap redirect
+type Click struct {
+	Base
+	LinkID    uint      `gorm:"index;not null" json:"link_id"`
+	Code      string    `gorm:"index;not null;size:20" json:"code"`
+	ClickedAt time.Time `gorm:"index;not null" json:"clicked_at"`
+	Referrer  string    `gorm:"type:text" json:"referrer"`
+	UserAgent string    `gorm:"type:text" json:"user_agent"`
+	IPHash    string    `gorm:"type:varchar(64)" json:"ip_hash"`
+}
+
+// TableName mengembalikan nama table
+func (Click) TableName() string {
+	return "clicks"
+}
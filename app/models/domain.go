@@ -0,0 +1,22 @@
+package models
+
+// Domain model untuk branded short domains. Every domain has its own code
+// namespace; links without a domain belong to the default domain, which is
+// served on every host that isn't registered.
+type Domain struct {
+	Base
+	Host      string `gorm:"uniqueIndex;not null;type:varchar(255)" json:"host"`
+	Scheme    string `gorm:"type:varchar(5);default:'https';not null" json:"scheme"`
+	Note      string `gorm:"type:text" json:"note,omitempty"`
+	CreatedBy string `gorm:"type:varchar(255)" json:"created_by,omitempty"`
+}
+
+// BaseURL returns the root of short URLs on the domain, e.g. https://go.example.com
+func (d *Domain) BaseURL() string {
+	return d.Scheme + "://" + d.Host
+}
+
+// TableName mengembalikan nama table
+func (Domain) TableName() string {
+	return "domains"
+}
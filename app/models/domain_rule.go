@@ -0,0 +1,22 @@
+package models
+
+// Domain rule actions
+const (
+	DomainRuleBlock = "block"
+	DomainRuleAllow = "allow"
+)
+
+// DomainRule model untuk block/allow list domain tujuan link. A rule applies to
+// the domain and all of its subdomains; the most specific rule wins.
+type DomainRule struct {
+	Base
+	Domain    string `gorm:"uniqueIndex;not null;type:varchar(253)" json:"domain"`
+	Action    string `gorm:"type:varchar(10);not null" json:"action"`
+	Note      string `gorm:"type:text" json:"note,omitempty"`
+	CreatedBy string `gorm:"type:varchar(255)" json:"created_by,omitempty"`
+}
+
+// TableName mengembalikan nama table
+func (DomainRule) TableName() string {
+	return "domain_rules"
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// IdempotencyKey model untuk menyimpan response dari request dengan Idempotency-Key.
+// StatusCode 0 berarti request pertama masih diproses.
+type IdempotencyKey struct {
+	Base
+	APITokenID  uint      `gorm:"not null;uniqueIndex:idx_idempotency_token_key" json:"api_token_id"`
+	Key         string    `gorm:"not null;type:varchar(255);uniqueIndex:idx_idempotency_token_key" json:"key"`
+	RequestHash string    `gorm:"not null;type:varchar(64)" json:"-"`
+	StatusCode  int       `gorm:"not null;default:0" json:"status_code"`
+	ContentType string    `gorm:"type:varchar(255)" json:"-"`
+	Response    []byte    `gorm:"type:bytea" json:"-"`
+	ExpiresAt   time.Time `gorm:"index;not null" json:"expires_at"`
+}
+
+// TableName mengembalikan nama table
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
+
+// IsPending reports whether the first request with this key hasn't finished yet
+func (k *IdempotencyKey) IsPending() bool {
+	return k.StatusCode == 0
+}
@@ -1,16 +1,50 @@
 package models
 
+import (
+	"boilerplate/pkg/tags"
+	"encoding/json"
+	"time"
+)
+
 // Link model untuk short links
 type Link struct {
 	Base
-	Code           string    `gorm:"uniqueIndex;not null;size:20" json:"code"`
-	OriginalURL    string    `gorm:"not null;type:text" json:"original_url"`
-	IsAPIGenerated bool      `gorm:"default:false;not null" json:"is_api_generated"`
-	APITokenID     *uint     `gorm:"index" json:"api_token_id,omitempty"`
-	APIToken       *APIToken `gorm:"foreignKey:APITokenID" json:"api_token,omitempty"`
+	Code           string     `gorm:"index;not null;size:20" json:"code"` // unique per domain, see database.migrateLinkDomainCodes
+	DomainID       *uint      `gorm:"index" json:"domain_id,omitempty"`
+	Domain         *Domain    `gorm:"foreignKey:DomainID" json:"domain,omitempty"`
+	OriginalURL    string     `gorm:"not null;type:text" json:"original_url"`
+	URLHash        string     `gorm:"type:varchar(64);index:idx_links_token_url_hash,priority:2" json:"-"`
+	IsAPIGenerated bool       `gorm:"default:false;not null" json:"is_api_generated"`
+	APITokenID     *uint      `gorm:"index;index:idx_links_token_url_hash,priority:1" json:"api_token_id,omitempty"`
+	APIToken       *APIToken  `gorm:"foreignKey:APITokenID" json:"api_token,omitempty"`
+	ExpiresAt      *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	MaxClicks      *int64     `json:"max_clicks,omitempty"`
+	ClickCount     int64      `gorm:"default:0;not null" json:"click_count"`
+	RedirectType   int        `gorm:"default:0;not null" json:"redirect_type"` // 301, 302, 307 or 308; 0 uses the configured default
+	ForwardQuery   bool       `gorm:"default:false;not null" json:"forward_query"`
+	Interstitial   bool       `gorm:"default:false;not null" json:"interstitial"` // show the preview page with a countdown before redirecting
+	PasswordHash   string     `gorm:"type:varchar(255);default:'';not null" json:"-"`
+	Title          string     `gorm:"type:varchar(255);default:'';not null" json:"title"`
+	Note           string     `gorm:"type:text;default:'';not null" json:"note"`
+	Tags           tags.List  `gorm:"type:text[];default:'{}';not null;index:idx_links_tags,type:gin" json:"tags"`
+	CreatedBy      string     `gorm:"type:varchar(255);default:'';not null;index" json:"created_by"`
 }
 
 // TableName mengembalikan nama table
 func (Link) TableName() string {
 	return "links"
 }
+
+// IsProtected reports whether visitors must enter a password to follow the link
+func (l *Link) IsProtected() bool {
+	return l.PasswordHash != ""
+}
+
+// MarshalJSON adds password_protected in place of the password hash
+func (l Link) MarshalJSON() ([]byte, error) {
+	type link Link
+	return json.Marshal(struct {
+		link
+		PasswordProtected bool `json:"password_protected"`
+	}{link(l), l.IsProtected()})
+}
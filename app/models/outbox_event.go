@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Outbox event statuses
+const (
+	OutboxStatusPending   = "pending"
+	OutboxStatusDelivered = "delivered"
+	OutboxStatusDead      = "dead"
+)
+
+// OutboxEvent model untuk click events yang menunggu dikirim ke event sink
+type OutboxEvent struct {
+	Base
+	APITokenID    uint       `gorm:"index;not null" json:"api_token_id"`
+	APIToken      *APIToken  `gorm:"foreignKey:APITokenID" json:"api_token,omitempty"`
+	LinkID        uint       `gorm:"index;not null" json:"link_id"`
+	Payload       string     `gorm:"type:text;not null" json:"payload"`
+	Status        string     `gorm:"type:varchar(20);default:pending;not null;index:idx_outbox_status_next" json:"status"`
+	Attempts      int        `gorm:"default:0;not null" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_outbox_status_next" json:"next_attempt_at"`
+	LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+// TableName mengembalikan nama table
+func (OutboxEvent) TableName() string {
+	return "outbox_events"
+}
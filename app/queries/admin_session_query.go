@@ -0,0 +1,48 @@
+package queries
+
+import (
+	"boilerplate/app/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AdminSessionQuery handles database operations for admin sessions
+type AdminSessionQuery struct {
+	DB *gorm.DB
+}
+
+// Create creates a new admin session
+func (q *AdminSessionQuery) Create(session *models.AdminSession) error {
+	return q.DB.Create(session).Error
+}
+
+// GetByTokenHash retrieves a session and its admin user by the hashed session ID
+func (q *AdminSessionQuery) GetByTokenHash(tokenHash string) (*models.AdminSession, error) {
+	var session models.AdminSession
+	err := q.DB.Preload("AdminUser").Where("token_hash = ?", tokenHash).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Touch updates the last activity time of a session
+func (q *AdminSessionQuery) Touch(id uint, lastSeenAt time.Time) error {
+	return q.DB.Model(&models.AdminSession{}).Where("id = ?", id).Update("last_seen_at", lastSeenAt).Error
+}
+
+// Delete soft deletes a session by ID
+func (q *AdminSessionQuery) Delete(id uint) error {
+	return q.DB.Delete(&models.AdminSession{}, id).Error
+}
+
+// DeleteByUser soft deletes all sessions of an admin user except exceptID (0 for none)
+func (q *AdminSessionQuery) DeleteByUser(userID, exceptID uint) error {
+	return q.DB.Where("admin_user_id = ? AND id <> ?", userID, exceptID).Delete(&models.AdminSession{}).Error
+}
+
+// DeleteExpired soft deletes sessions past their absolute expiry or idle since idleSince
+func (q *AdminSessionQuery) DeleteExpired(now, idleSince time.Time) error {
+	return q.DB.Where("expires_at <= ? OR last_seen_at <= ?", now, idleSince).Delete(&models.AdminSession{}).Error
+}
@@ -71,6 +71,13 @@ func (q *AdminUserQuery) Update(id uint, user *models.AdminUser, newPassword str
 	return q.DB.Model(&models.AdminUser{}).Where("id = ?", id).Updates(user).Error
 }
 
+// CountByRole returns the number of admin users with the given role
+func (q *AdminUserQuery) CountByRole(role string) (int64, error) {
+	var count int64
+	err := q.DB.Model(&models.AdminUser{}).Where("role = ?", role).Count(&count).Error
+	return count, err
+}
+
 // Delete soft deletes an admin user
 func (q *AdminUserQuery) Delete(id uint) error {
 	return q.DB.Delete(&models.AdminUser{}, id).Error
@@ -2,6 +2,7 @@ package queries
 
 import (
 	"boilerplate/app/models"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -11,14 +12,20 @@ type APITokenQuery struct {
 	DB *gorm.DB
 }
 
-// GetByToken retrieves an API token by token string
-func (q *APITokenQuery) GetByToken(token string) (*models.APIToken, error) {
-	var apiToken models.APIToken
-	err := q.DB.Where("token = ?", token).First(&apiToken).Error
-	if err != nil {
-		return nil, err
-	}
-	return &apiToken, nil
+// ListByPrefix retrieves the API tokens sharing a lookup prefix; callers must
+// compare the token hash to find the actual match
+func (q *APITokenQuery) ListByPrefix(prefix string) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	err := q.DB.Preload("Domain").Where("token_prefix = ?", prefix).Find(&tokens).Error
+	return tokens, err
+}
+
+// UpdateSecret replaces the hashed secret and prefix of an API token
+func (q *APITokenQuery) UpdateSecret(id uint, tokenHash, tokenPrefix string) error {
+	return q.DB.Model(&models.APIToken{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"token_hash":   tokenHash,
+		"token_prefix": tokenPrefix,
+	}).Error
 }
 
 // Create creates a new API token
@@ -29,7 +36,7 @@ func (q *APITokenQuery) Create(token *models.APIToken) error {
 // List retrieves all API tokens
 func (q *APITokenQuery) List() ([]models.APIToken, error) {
 	var tokens []models.APIToken
-	err := q.DB.Order("created_at DESC").Find(&tokens).Error
+	err := q.DB.Preload("Domain").Order("created_at DESC").Find(&tokens).Error
 	return tokens, err
 }
 
@@ -52,3 +59,46 @@ func (q *APITokenQuery) Delete(id uint) error {
 func (q *APITokenQuery) Update(id uint, token *models.APIToken) error {
 	return q.DB.Model(&models.APIToken{}).Where("id = ?", id).Updates(token).Error
 }
+
+// Touch records when and from where an API token was last used
+func (q *APITokenQuery) Touch(id uint, usedAt time.Time, ip string) error {
+	return q.DB.Model(&models.APIToken{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"last_used_at": usedAt,
+		"last_used_ip": ip,
+	}).Error
+}
+
+// Revoke marks an API token as revoked. It returns false if the token was
+// already revoked, so the original revocation metadata is kept.
+func (q *APITokenQuery) Revoke(id uint, reason, revokedBy string) (bool, error) {
+	result := q.DB.Model(&models.APIToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{
+			"revoked_at":     time.Now().UTC(),
+			"revoked_reason": reason,
+			"revoked_by":     revokedBy,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UpdateLimits sets the request rate limit, link quotas, link de-duplication
+// and expiry of an API token, including back to 0 (default / unlimited),
+// false and no expiry, which Update would skip
+func (q *APITokenQuery) UpdateLimits(id uint, requestsPerMinute, dailyLinkQuota, monthlyLinkQuota int, dedupeLinks bool, expiresAt *time.Time) error {
+	return q.DB.Model(&models.APIToken{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"requests_per_minute": requestsPerMinute,
+		"daily_link_quota":    dailyLinkQuota,
+		"monthly_link_quota":  monthlyLinkQuota,
+		"dedupe_links":        dedupeLinks,
+		"expires_at":          expiresAt,
+	}).Error
+}
+
+// SetDomain moves the links an API token creates from now on to a domain, nil
+// being the default domain
+func (q *APITokenQuery) SetDomain(id uint, domainID *uint) error {
+	return q.DB.Model(&models.APIToken{}).Where("id = ?", id).Update("domain_id", domainID).Error
+}
@@ -0,0 +1,89 @@
+package queries
+
+import (
+	"boilerplate/app/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ClickQuery handles database operations for click events
+type ClickQuery struct {
+	DB *gorm.DB
+}
+
+// DailyClickCount is a single point of a per-day click series
+type DailyClickCount struct {
+	Date   string `json:"date"`
+	Clicks int64  `json:"clicks"`
+}
+
+// ReferrerCount is the number of clicks coming from a single referrer
+type ReferrerCount struct {
+	Referrer string `json:"referrer"`
+	Clicks   int64  `json:"clicks"`
+}
+
+// Create stores a click event, bounded by the given context. When an outbox
+// event is given it is written in the same transaction, so a click is never
+// stored without its delivery record and vice versa.
+func (q *ClickQuery) Create(ctx context.Context, click *models.Click, event *models.OutboxEvent) error {
+	return q.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(click).Error; err != nil {
+			return err
+		}
+		if event != nil {
+			return tx.Create(event).Error
+		}
+		return nil
+	})
+}
+
+// CountByLink returns the total number of clicks recorded for a link
+func (q *ClickQuery) CountByLink(linkID uint) (int64, error) {
+	var count int64
+	err := q.DB.Model(&models.Click{}).Where("link_id = ?", linkID).Count(&count).Error
+	return count, err
+}
+
+// DailyCounts returns clicks per day for a link since the given time.
+// Days without clicks are filled with zero so the series is continuous.
+func (q *ClickQuery) DailyCounts(linkID uint, since time.Time) ([]DailyClickCount, error) {
+	var rows []DailyClickCount
+	err := q.DB.Model(&models.Click{}).
+		Select("TO_CHAR(DATE(clicked_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD') AS date, COUNT(*) AS clicks").
+		Where("link_id = ? AND clicked_at >= ?", linkID, since).
+		Group("DATE(clicked_at AT TIME ZONE 'UTC')").
+		Order("DATE(clicked_at AT TIME ZONE 'UTC')").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Date] = row.Clicks
+	}
+
+	var series []DailyClickCount
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for day := since.UTC().Truncate(24 * time.Hour); !day.After(today); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		series = append(series, DailyClickCount{Date: date, Clicks: counts[date]})
+	}
+	return series, nil
+}
+
+// TopReferrers returns the referrers with the most clicks for a link
+func (q *ClickQuery) TopReferrers(linkID uint, since time.Time, limit int) ([]ReferrerCount, error) {
+	var rows []ReferrerCount
+	err := q.DB.Model(&models.Click{}).
+		Select("COALESCE(NULLIF(referrer, ''), 'direct') AS referrer, COUNT(*) AS clicks").
+		Where("link_id = ? AND clicked_at >= ?", linkID, since).
+		Group("COALESCE(NULLIF(referrer, ''), 'direct')").
+		Order("clicks DESC").
+		Limit(limit).
+		Scan(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,79 @@
+package queries
+
+import (
+	"boilerplate/app/models"
+
+	"gorm.io/gorm"
+)
+
+// DomainQuery handles database operations for short domains
+type DomainQuery struct {
+	DB *gorm.DB
+}
+
+// List retrieves all domains ordered by host
+func (q *DomainQuery) List() ([]models.Domain, error) {
+	var domains []models.Domain
+	err := q.DB.Order("host").Find(&domains).Error
+	return domains, err
+}
+
+// GetByID retrieves a domain by ID
+func (q *DomainQuery) GetByID(id uint) (*models.Domain, error) {
+	var domain models.Domain
+	err := q.DB.First(&domain, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &domain, nil
+}
+
+// GetByHost retrieves a domain by its host
+func (q *DomainQuery) GetByHost(host string) (*models.Domain, error) {
+	var domain models.Domain
+	err := q.DB.Where("host = ?", host).First(&domain).Error
+	if err != nil {
+		return nil, err
+	}
+	return &domain, nil
+}
+
+// Hosts returns the hosts of all domains
+func (q *DomainQuery) Hosts() ([]string, error) {
+	var hosts []string
+	err := q.DB.Model(&models.Domain{}).Pluck("host", &hosts).Error
+	return hosts, err
+}
+
+// Create creates a new domain
+func (q *DomainQuery) Create(domain *models.Domain) error {
+	return q.DB.Create(domain).Error
+}
+
+// Update sets the scheme and note of a domain; the host can't change since
+// it is part of every short URL handed out
+func (q *DomainQuery) Update(id uint, scheme, note string) error {
+	return q.DB.Model(&models.Domain{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"scheme": scheme,
+		"note":   note,
+	}).Error
+}
+
+// InUse reports whether links, including soft-deleted ones whose codes stay
+// reserved, or API tokens still belong to the domain
+func (q *DomainQuery) InUse(id uint) (bool, error) {
+	var links, tokens int64
+	if err := q.DB.Unscoped().Model(&models.Link{}).Where("domain_id = ?", id).Count(&links).Error; err != nil {
+		return false, err
+	}
+	if err := q.DB.Model(&models.APIToken{}).Where("domain_id = ?", id).Count(&tokens).Error; err != nil {
+		return false, err
+	}
+	return links > 0 || tokens > 0, nil
+}
+
+// Delete permanently deletes a domain, so the host can be added again
+func (q *DomainQuery) Delete(id uint) (bool, error) {
+	result := q.DB.Unscoped().Delete(&models.Domain{}, id)
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,54 @@
+package queries
+
+import (
+	"boilerplate/app/models"
+
+	"gorm.io/gorm"
+)
+
+// DomainRuleQuery handles database operations for domain rules
+type DomainRuleQuery struct {
+	DB *gorm.DB
+}
+
+// List retrieves all domain rules ordered by domain
+func (q *DomainRuleQuery) List() ([]models.DomainRule, error) {
+	var rules []models.DomainRule
+	err := q.DB.Order("domain").Find(&rules).Error
+	return rules, err
+}
+
+// Create creates a new domain rule
+func (q *DomainRuleQuery) Create(rule *models.DomainRule) error {
+	return q.DB.Create(rule).Error
+}
+
+// Delete permanently deletes a domain rule, so the domain can be added again
+func (q *DomainRuleQuery) Delete(id uint) (bool, error) {
+	result := q.DB.Unscoped().Delete(&models.DomainRule{}, id)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ExistsDomain checks if a rule for the domain already exists
+func (q *DomainRuleQuery) ExistsDomain(domain string) (bool, error) {
+	var count int64
+	err := q.DB.Model(&models.DomainRule{}).Where("domain = ?", domain).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// MostSpecific returns the rule for the longest of the given domains, or nil
+// if none of them has a rule
+func (q *DomainRuleQuery) MostSpecific(domains []string) (*models.DomainRule, error) {
+	var rules []models.DomainRule
+	err := q.DB.Where("domain IN ?", domains).
+		Order("length(domain) DESC").
+		Limit(1).
+		Find(&rules).Error
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+	return &rules[0], nil
+}
@@ -0,0 +1,64 @@
+package queries
+
+import (
+	"boilerplate/app/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyKeyQuery handles database operations for idempotency keys
+type IdempotencyKeyQuery struct {
+	DB *gorm.DB
+}
+
+// Reserve stores a pending key, taking over an expired row with the same
+// token and key. It returns false when a live row already exists.
+func (q *IdempotencyKeyQuery) Reserve(key *models.IdempotencyKey) (bool, error) {
+	result := q.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "api_token_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"request_hash", "status_code", "content_type", "response", "expires_at", "created_at", "updated_at",
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Lte{Column: clause.Column{Table: models.IdempotencyKey{}.TableName(), Name: "expires_at"}, Value: time.Now().UTC()},
+		}},
+	}).Create(key)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Get retrieves an unexpired key of an API token
+func (q *IdempotencyKeyQuery) Get(tokenID uint, key string) (*models.IdempotencyKey, error) {
+	var idempotencyKey models.IdempotencyKey
+	err := q.DB.Where("api_token_id = ? AND key = ? AND expires_at > ?", tokenID, key, time.Now().UTC()).
+		First(&idempotencyKey).Error
+	if err != nil {
+		return nil, err
+	}
+	return &idempotencyKey, nil
+}
+
+// Complete stores the response of the request that reserved the key and
+// keeps it until expiresAt
+func (q *IdempotencyKeyQuery) Complete(id uint, statusCode int, contentType string, response []byte, expiresAt time.Time) error {
+	return q.DB.Model(&models.IdempotencyKey{}).Where("id = ?", id).Updates(map[string]any{
+		"status_code":  statusCode,
+		"content_type": contentType,
+		"response":     response,
+		"expires_at":   expiresAt,
+	}).Error
+}
+
+// Release permanently removes a key, so the request can be retried with it
+func (q *IdempotencyKeyQuery) Release(id uint) error {
+	return q.DB.Unscoped().Delete(&models.IdempotencyKey{}, id).Error
+}
+
+// DeleteExpired permanently removes keys that expired before now
+func (q *IdempotencyKeyQuery) DeleteExpired(now time.Time) error {
+	return q.DB.Unscoped().Where("expires_at <= ?", now).Delete(&models.IdempotencyKey{}).Error
+}
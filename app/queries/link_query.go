@@ -2,7 +2,16 @@ package queries
 
 import (
 	"boilerplate/app/models"
+	"boilerplate/pkg/nullable"
+	"boilerplate/pkg/tags"
+	"boilerplate/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -11,10 +20,21 @@ type LinkQuery struct {
 	DB *gorm.DB
 }
 
-// GetByCode retrieves a link by its short code
-func (q *LinkQuery) GetByCode(code string) (*models.Link, error) {
+// inDomain limits a link query to the code namespace of a domain, nil being
+// the default domain
+func inDomain(domainID *uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if domainID == nil || *domainID == 0 {
+			return db.Where("domain_id IS NULL")
+		}
+		return db.Where("domain_id = ?", *domainID)
+	}
+}
+
+// GetByCode retrieves a link by its short code on a domain
+func (q *LinkQuery) GetByCode(domainID *uint, code string) (*models.Link, error) {
 	var link models.Link
-	err := q.DB.Preload("APIToken").Where("code = ?", code).First(&link).Error
+	err := q.DB.Preload("APIToken").Preload("Domain").Scopes(inDomain(domainID)).Where("code = ?", code).First(&link).Error
 	if err != nil {
 		return nil, err
 	}
@@ -23,47 +43,407 @@ func (q *LinkQuery) GetByCode(code string) (*models.Link, error) {
 
 // Create creates a new link
 func (q *LinkQuery) Create(link *models.Link) error {
+	link.URLHash = utils.HashURL(link.OriginalURL)
 	return q.DB.Create(link).Error
 }
 
-// List retrieves all links with pagination and optional search
-func (q *LinkQuery) List(limit, offset int, search string) ([]models.Link, int64, error) {
-	var links []models.Link
-	var count int64
+// LinkQuota caps the number of links an API token may create in a period
+type LinkQuota struct {
+	Name  string
+	Limit int
+	Since time.Time
+	Until time.Time
+}
 
-	query := q.DB.Model(&models.Link{})
+// QuotaExceededError is returned by CreateWithinQuota when a quota is used up
+type QuotaExceededError struct {
+	Quota LinkQuota
+}
 
-	// Apply search filter if provided
-	if search != "" {
-		searchPattern := "%" + search + "%"
-		query = query.Where("code LIKE ? OR original_url LIKE ?", searchPattern, searchPattern)
-	}
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s link quota of %d exceeded", e.Quota.Name, e.Quota.Limit)
+}
+
+// CreateWithinQuota creates a link for its API token unless one of the quotas
+// is used up. Soft-deleted links still count, so deleting doesn't free quota.
+// An advisory lock per token serializes concurrent creates so the quota is exact.
+//
+// With reuse, an active link of the token with the same destination (URLHash)
+// and the same limits is returned instead, without creating or counting a
+// link. Password protected links are never reused. The returned link is nil
+// when link was created.
+func (q *LinkQuery) CreateWithinQuota(link *models.Link, reuse bool, quotas ...LinkQuota) (*models.Link, error) {
+	link.URLHash = utils.HashURL(link.OriginalURL)
+
+	var existing *models.Link
+	err := q.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('link_quota'), ?)", *link.APITokenID).Error; err != nil {
+			return err
+		}
+
+		if reuse {
+			var links []models.Link
+			err := tx.Scopes(inDomain(link.DomainID)).
+				Preload("Domain").
+				Where("api_token_id = ? AND url_hash = ?", *link.APITokenID, link.URLHash).
+				Where("expires_at IS NOT DISTINCT FROM ? AND max_clicks IS NOT DISTINCT FROM ? AND redirect_type = ? AND forward_query = ? AND interstitial = ?", link.ExpiresAt, link.MaxClicks, link.RedirectType, link.ForwardQuery, link.Interstitial).
+				Where("password_hash = ''").
+				Where("(expires_at IS NULL OR expires_at > ?) AND (max_clicks IS NULL OR click_count < max_clicks)", time.Now()).
+				Order("created_at DESC").
+				Limit(1).
+				Find(&links).Error
+			if err != nil {
+				return err
+			}
+			if len(links) > 0 {
+				existing = &links[0]
+				return nil
+			}
+		}
 
+		for _, quota := range quotas {
+			var count int64
+			err := tx.Unscoped().Model(&models.Link{}).
+				Where("api_token_id = ? AND created_at >= ?", *link.APITokenID, quota.Since).
+				Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count >= int64(quota.Limit) {
+				return &QuotaExceededError{Quota: quota}
+			}
+		}
+
+		return tx.Create(link).Error
+	})
+	return existing, err
+}
+
+// List retrieves the links matching the filter with pagination
+func (q *LinkQuery) List(filter LinkFilter, limit, offset int) ([]models.Link, int64, error) {
+	return q.list(filter, limit, offset, "APIToken", "Domain")
+}
+
+// ListByToken retrieves the links created by an API token matching the filter with pagination
+func (q *LinkQuery) ListByToken(tokenID uint, filter LinkFilter, limit, offset int) ([]models.Link, int64, error) {
+	filter.TokenID = tokenID
+	return q.list(filter, limit, offset, "Domain")
+}
+
+// list applies the filter, counting, sorting, pagination and the given preloads
+func (q *LinkQuery) list(filter LinkFilter, limit, offset int, preloads ...string) ([]models.Link, int64, error) {
+	var links []models.Link
+	var count int64
+
+	query := q.filtered(filter)
 	if err := query.Count(&count).Error; err != nil {
 		return nil, 0, err
 	}
 
-	query = query.Preload("APIToken").Limit(limit).Offset(offset).Order("created_at DESC")
-	err := query.Find(&links).Error
+	for _, preload := range preloads {
+		query = query.Preload(preload)
+	}
+
+	err := query.Limit(limit).Offset(offset).Order(linkOrder(filter.Sort)).Find(&links).Error
 	return links, count, err
 }
 
-// Delete soft deletes a link by code
-func (q *LinkQuery) Delete(code string) error {
-	return q.DB.Where("code = ?", code).Delete(&models.Link{}).Error
+// GetByCodeAndToken retrieves a link by code on a domain only if it was
+// created by the given API token
+func (q *LinkQuery) GetByCodeAndToken(domainID *uint, code string, tokenID uint) (*models.Link, error) {
+	var link models.Link
+	err := q.DB.Preload("Domain").Scopes(inDomain(domainID)).Where("code = ? AND api_token_id = ?", code, tokenID).First(&link).Error
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
 }
 
-// Update updates a link by code
-func (q *LinkQuery) Update(code string, link *models.Link) error {
-	return q.DB.Model(&models.Link{}).Where("code = ?", code).Updates(link).Error
+// Delete soft deletes a link by ID
+func (q *LinkQuery) Delete(id uint) error {
+	return q.DB.Delete(&models.Link{}, id).Error
 }
 
-// Exists checks if a code already exists
-func (q *LinkQuery) Exists(code string) (bool, error) {
+// Update updates a link by ID. Zero fields of link are left unchanged.
+func (q *LinkQuery) Update(id uint, link *models.Link) error {
+	if link.OriginalURL != "" {
+		link.URLHash = utils.HashURL(link.OriginalURL)
+	}
+	return q.DB.Model(&models.Link{}).Where("id = ?", id).Updates(link).Error
+}
+
+// LinkDetails are link fields whose zero value can be set on purpose, so
+// Update can't change them. Nil and unset fields are kept.
+type LinkDetails struct {
+	// ExpiresAt and MaxClicks are removed when set to null
+	ExpiresAt    nullable.Value[time.Time]
+	MaxClicks    nullable.Value[int64]
+	Title        *string
+	Note         *string
+	Tags         tags.List
+	RedirectType *int
+	ForwardQuery *bool
+	Interstitial *bool
+	// Password is hashed before it is stored, "" removes the password
+	Password *string
+}
+
+// UpdateWithDetails applies Update and sets the details of a link in one
+// transaction, so an edit is never half applied
+func (q *LinkQuery) UpdateWithDetails(id uint, link *models.Link, details LinkDetails) error {
+	// Hashed before the transaction, bcrypt is slow on purpose
+	updates, err := q.detailUpdates(details)
+	if err != nil {
+		return err
+	}
+
+	return q.DB.Transaction(func(tx *gorm.DB) error {
+		txQuery := &LinkQuery{DB: tx}
+		if err := txQuery.Update(id, link); err != nil {
+			return err
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(&models.Link{}).Where("id = ?", id).Updates(updates).Error
+	})
+}
+
+// detailUpdates returns the columns to update for the set details
+func (q *LinkQuery) detailUpdates(details LinkDetails) (map[string]interface{}, error) {
+	updates := map[string]interface{}{}
+	if details.ExpiresAt.Set {
+		updates["expires_at"] = nil
+		if details.ExpiresAt.Value != nil {
+			updates["expires_at"] = *details.ExpiresAt.Value
+		}
+	}
+	if details.MaxClicks.Set {
+		updates["max_clicks"] = nil
+		if details.MaxClicks.Value != nil {
+			updates["max_clicks"] = *details.MaxClicks.Value
+		}
+	}
+	if details.Title != nil {
+		updates["title"] = *details.Title
+	}
+	if details.Note != nil {
+		updates["note"] = *details.Note
+	}
+	if details.Tags != nil {
+		updates["tags"] = details.Tags
+	}
+	if details.RedirectType != nil {
+		updates["redirect_type"] = *details.RedirectType
+	}
+	if details.ForwardQuery != nil {
+		updates["forward_query"] = *details.ForwardQuery
+	}
+	if details.Interstitial != nil {
+		updates["interstitial"] = *details.Interstitial
+	}
+	if details.Password != nil {
+		hash, err := q.HashPassword(*details.Password)
+		if err != nil {
+			return nil, err
+		}
+		updates["password_hash"] = hash
+	}
+	return updates, nil
+}
+
+// HashPassword returns the bcrypt hash of a link password, or "" for no password
+func (q *LinkQuery) HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+// ValidatePassword verifies the password of a protected link
+func (q *LinkQuery) ValidatePassword(link *models.Link, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password))
+	if err != nil {
+		return errors.New("invalid password")
+	}
+	return nil
+}
+
+// ConsumeClick atomically increments the click counter of a link, refusing
+// once MaxClicks has been reached. It returns false if the link is exhausted.
+func (q *LinkQuery) ConsumeClick(id uint) (bool, error) {
+	result := q.DB.Model(&models.Link{}).
+		Where("id = ? AND (max_clicks IS NULL OR click_count < max_clicks)", id).
+		UpdateColumn("click_count", gorm.Expr("click_count + 1"))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// IncrementClicks increments the click counter of a link unconditionally
+func (q *LinkQuery) IncrementClicks(ctx context.Context, id uint) error {
+	return q.DB.WithContext(ctx).Model(&models.Link{}).
+		Where("id = ?", id).
+		UpdateColumn("click_count", gorm.Expr("click_count + 1")).Error
+}
+
+// Exists checks if a code already exists on a domain, including on a
+// soft-deleted link since the unique index still covers it
+func (q *LinkQuery) Exists(domainID *uint, code string) (bool, error) {
 	var count int64
-	err := q.DB.Model(&models.Link{}).Where("code = ?", code).Count(&count).Error
+	err := q.DB.Unscoped().Model(&models.Link{}).Scopes(inDomain(domainID)).Where("code = ?", code).Count(&count).Error
 	if err != nil {
 		return false, err
 	}
 	return count > 0, nil
 }
+
+// ExistingCodes returns which of the codes are taken on a domain, including
+// by soft-deleted links since the unique index still covers them
+func (q *LinkQuery) ExistingCodes(domainID *uint, codes []string) (map[string]bool, error) {
+	const chunkSize = 1000
+	taken := make(map[string]bool)
+	for start := 0; start < len(codes); start += chunkSize {
+		end := min(start+chunkSize, len(codes))
+		var found []string
+		err := q.DB.Unscoped().Model(&models.Link{}).
+			Scopes(inDomain(domainID)).
+			Where("code IN ?", codes[start:end]).
+			Pluck("code", &found).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, code := range found {
+			taken[code] = true
+		}
+	}
+	return taken, nil
+}
+
+// CreateMany creates links in a single transaction, all or nothing
+func (q *LinkQuery) CreateMany(links []models.Link) error {
+	for i := range links {
+		links[i].URLHash = utils.HashURL(links[i].OriginalURL)
+	}
+	return q.DB.Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(links, 500).Error
+	})
+}
+
+// LinkFilter narrows down listed and exported links. Zero fields don't filter.
+type LinkFilter struct {
+	// Search matches code, URL and title by substring (trigram indexed) and
+	// title and note by words (full-text)
+	Search string
+	Tag    string
+	// Source is "api" (created with an API token), "admin" (admin panel or
+	// import) or "web" (public shortener form)
+	Source  string
+	TokenID uint
+	// DomainID filters by domain, 0 being the default domain
+	DomainID    *uint
+	CreatedBy   string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// Status is "active" or "inactive" (expired or out of clicks)
+	Status string
+	// Sort is one of LinkSorts, prefixed with "-" for descending order
+	Sort string
+}
+
+// LinkSorts are the columns links can be sorted by
+var LinkSorts = []string{"created_at", "updated_at", "click_count", "code", "title", "expires_at"}
+
+// DefaultLinkSort lists the newest links first
+const DefaultLinkSort = "-created_at"
+
+// IsValidLinkSort reports whether sort is a column of LinkSorts, optionally
+// prefixed with "-"
+func IsValidLinkSort(sort string) bool {
+	column := strings.TrimPrefix(sort, "-")
+	for _, s := range LinkSorts {
+		if s == column {
+			return true
+		}
+	}
+	return false
+}
+
+// linkOrder returns the ORDER BY clause of a sort, with the ID as tie breaker
+// so pages are stable
+func linkOrder(sort string) string {
+	if !IsValidLinkSort(sort) {
+		sort = DefaultLinkSort
+	}
+	if column, desc := strings.CutPrefix(sort, "-"); desc {
+		return column + " DESC, id DESC"
+	}
+	return sort + " ASC, id ASC"
+}
+
+// filtered returns a link query with the filter applied
+func (q *LinkQuery) filtered(filter LinkFilter) *gorm.DB {
+	query := q.DB.Model(&models.Link{})
+	if filter.Search != "" {
+		// ILIKE '%..%' uses the trigram indexes, the tsvector expression
+		// matches the full-text index, see database.migrateLinkSearchIndexes
+		searchPattern := "%" + escapeLike(filter.Search) + "%"
+		query = query.Where(
+			"code ILIKE ? OR original_url ILIKE ? OR title ILIKE ? OR to_tsvector('simple', title || ' ' || note) @@ websearch_to_tsquery('simple', ?)",
+			searchPattern, searchPattern, searchPattern, filter.Search,
+		)
+	}
+	if filter.Tag != "" {
+		query = query.Where("tags @> ?", tags.List{strings.ToLower(filter.Tag)})
+	}
+	switch filter.Source {
+	case "api":
+		query = query.Where("is_api_generated")
+	case "admin":
+		query = query.Where("NOT is_api_generated AND created_by <> ''")
+	case "web":
+		query = query.Where("NOT is_api_generated AND created_by = ''")
+	}
+	if filter.TokenID != 0 {
+		query = query.Where("api_token_id = ?", filter.TokenID)
+	}
+	if filter.DomainID != nil {
+		query = query.Scopes(inDomain(filter.DomainID))
+	}
+	if filter.CreatedBy != "" {
+		query = query.Where("created_by = ?", filter.CreatedBy)
+	}
+	if filter.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		query = query.Where("created_at < ?", *filter.CreatedTo)
+	}
+	switch filter.Status {
+	case "active":
+		query = query.Where("(expires_at IS NULL OR expires_at > ?) AND (max_clicks IS NULL OR click_count < max_clicks)", time.Now())
+	case "inactive":
+		query = query.Where("(expires_at IS NOT NULL AND expires_at <= ?) OR (max_clicks IS NOT NULL AND click_count >= max_clicks)", time.Now())
+	}
+	return query
+}
+
+// escapeLike escapes the LIKE wildcards in a search term
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(term)
+}
+
+// Export calls fn with every link matching the filter, in batches of
+// batchSize ordered by ID, so all links can be streamed without loading them
+// at once. Returning an error from fn stops the export.
+func (q *LinkQuery) Export(filter LinkFilter, batchSize int, fn func([]models.Link) error) error {
+	var links []models.Link
+	return q.filtered(filter).Preload("Domain").FindInBatches(&links, batchSize, func(tx *gorm.DB, batch int) error {
+		return fn(links)
+	}).Error
+}
@@ -0,0 +1,141 @@
+package queries
+
+import (
+	"boilerplate/app/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OutboxQuery handles database operations for outbox events
+type OutboxQuery struct {
+	DB *gorm.DB
+}
+
+// OutboxStatusCount is the number of outbox events in a status
+type OutboxStatusCount struct {
+	Status string `json:"status"`
+	Count  int64  `json:"count"`
+}
+
+// Claim locks up to limit due pending events and pushes their next attempt
+// time forward by lease, so other dispatchers (prefork children, other
+// instances) skip them. If the claiming process dies the lease simply expires.
+func (q *OutboxQuery) Claim(limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	var events []models.OutboxEvent
+	now := time.Now().UTC()
+
+	err := q.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.OutboxStatusPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&events).Error
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(events))
+		for i, event := range events {
+			ids[i] = event.ID
+		}
+		return tx.Model(&models.OutboxEvent{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+
+	// Load tokens after the lock is released
+	tokenIDs := make([]uint, len(events))
+	for i, event := range events {
+		tokenIDs[i] = event.APITokenID
+	}
+	var tokens []models.APIToken
+	if err := q.DB.Where("id IN ?", tokenIDs).Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	tokensByID := make(map[uint]*models.APIToken, len(tokens))
+	for i := range tokens {
+		tokensByID[tokens[i].ID] = &tokens[i]
+	}
+	for i := range events {
+		events[i].APIToken = tokensByID[events[i].APITokenID]
+	}
+	return events, nil
+}
+
+// MarkDelivered marks an event as successfully delivered
+func (q *OutboxQuery) MarkDelivered(id uint) error {
+	now := time.Now().UTC()
+	return q.DB.Model(&models.OutboxEvent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       models.OutboxStatusDelivered,
+		"delivered_at": now,
+		"last_error":   "",
+	}).Error
+}
+
+// MarkFailed records a failed delivery attempt and schedules the next one,
+// or moves the event to the dead-letter state when dead is true
+func (q *OutboxQuery) MarkFailed(id uint, attempts int, nextAttemptAt time.Time, lastError string, dead bool) error {
+	status := models.OutboxStatusPending
+	if dead {
+		status = models.OutboxStatusDead
+	}
+	return q.DB.Model(&models.OutboxEvent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          status,
+		"attempts":        attempts,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	}).Error
+}
+
+// List retrieves outbox events with pagination, optionally filtered by status
+func (q *OutboxQuery) List(status string, limit, offset int) ([]models.OutboxEvent, int64, error) {
+	var events []models.OutboxEvent
+	var count int64
+
+	query := q.DB.Model(&models.OutboxEvent{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Preload("APIToken").Limit(limit).Offset(offset).Order("created_at DESC").Find(&events).Error
+	return events, count, err
+}
+
+// CountByStatus returns the number of outbox events per status
+func (q *OutboxQuery) CountByStatus() ([]OutboxStatusCount, error) {
+	var counts []OutboxStatusCount
+	err := q.DB.Model(&models.OutboxEvent{}).
+		Select("status, COUNT(*) AS count").
+		Group("status").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// Retry moves a dead event back to pending so it is delivered on the next dispatch
+func (q *OutboxQuery) Retry(id uint) (bool, error) {
+	result := q.DB.Model(&models.OutboxEvent{}).
+		Where("id = ? AND status = ?", id, models.OutboxStatusDead).
+		Updates(map[string]interface{}{
+			"status":          models.OutboxStatusPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now().UTC(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// PurgeDelivered permanently removes delivered events older than before.
+// Outbox rows are transient delivery state, so they are not soft deleted.
+func (q *OutboxQuery) PurgeDelivered(before time.Time) error {
+	return q.DB.Unscoped().
+		Where("status = ? AND delivered_at < ?", models.OutboxStatusDelivered, before).
+		Delete(&models.OutboxEvent{}).Error
+}
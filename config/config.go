@@ -1,8 +1,12 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type DatabaseConfig struct {
@@ -14,7 +18,117 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
-var DB *DatabaseConfig
+// SessionConfig holds admin session settings
+type SessionConfig struct {
+	TTL          time.Duration
+	IdleTimeout  time.Duration
+	CookieSecure bool
+}
+
+// CacheConfig holds redirect cache settings
+type CacheConfig struct {
+	Size        int
+	TTL         time.Duration
+	NegativeTTL time.Duration
+}
+
+// RateLimitConfig holds rate limiter settings for click events and requests
+type RateLimitConfig struct {
+	// Store is "postgres" (shared by all processes) or "memory" (per process)
+	Store string
+
+	// Token bucket per client IP for POST /shorten
+	ShortenRequests int
+	ShortenPeriod   time.Duration
+
+	// Default token bucket per API token, overridden by APIToken.RequestsPerMinute
+	APIRequests int
+	APIPeriod   time.Duration
+
+	// Token bucket per client IP for wrong passwords on protected links
+	UnlockRequests int
+	UnlockPeriod   time.Duration
+}
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	// TrustProxy makes c.IP() read ProxyHeader on requests from loopback and
+	// private addresses, e.g. nginx or a load balancer in the VPC
+	TrustProxy  bool
+	ProxyHeader string
+}
+
+// URLPolicyConfig holds the rules link destinations are screened against
+type URLPolicyConfig struct {
+	// AllowedSchemes lists the URL schemes a link may point to
+	AllowedSchemes []string
+	// OwnHosts are our short domains; links to them (or subdomains) would loop
+	OwnHosts []string
+	// BlocklistFile is an optional file of SHA-256 hashes of known phishing
+	// and malware URL expressions, one per line
+	BlocklistFile string
+	// AllowlistOnly rejects every domain without an allow rule
+	AllowlistOnly bool
+}
+
+// BulkConfig holds the limits of bulk link creation and import
+type BulkConfig struct {
+	// BatchMaxItems caps the links of one POST /api/v1/links/batch request
+	BatchMaxItems int
+	// ImportMaxRows caps the rows of one admin import
+	ImportMaxRows int
+	// ImportMaxPasswordRows caps the rows with a password, each is hashed
+	// with bcrypt while the request waits
+	ImportMaxPasswordRows int
+}
+
+// RedirectConfig holds the defaults of short link redirects
+type RedirectConfig struct {
+	// DefaultType is the status code of links without their own redirect type
+	DefaultType int
+	// PermanentMaxAge is how long browsers and CDNs may cache a 301 or 308
+	PermanentMaxAge time.Duration
+	// UnlockTTL is how long a password protected link stays unlocked
+	UnlockTTL time.Duration
+}
+
+// PreviewConfig holds settings of the link preview page (/:code+) and of
+// links that always show it before redirecting
+type PreviewConfig struct {
+	// FetchTimeout bounds fetching the destination's title and favicon; 0
+	// disables fetching
+	FetchTimeout time.Duration
+	// CacheTTL is how long fetched titles and favicons are kept
+	CacheTTL time.Duration
+	// Countdown is how long the interstitial page waits before redirecting
+	Countdown time.Duration
+}
+
+// SinkConfig holds settings of click event sinks
+type SinkConfig struct {
+	// FileDir is the only directory file sinks may write to; a token's sink
+	// URL is a file name inside it. File sinks are disabled when it is empty.
+	FileDir string
+}
+
+// SecretsConfig holds the master key used to encrypt credentials at rest
+type SecretsConfig struct {
+	MasterKey []byte
+}
+
+var (
+	DB        *DatabaseConfig
+	Session   *SessionConfig
+	Secrets   *SecretsConfig
+	Cache     *CacheConfig
+	RateLimit *RateLimitConfig
+	Server    *ServerConfig
+	URLPolicy *URLPolicyConfig
+	Bulk      *BulkConfig
+	Redirect  *RedirectConfig
+	Preview   *PreviewConfig
+	Sink      *SinkConfig
+)
 
 // Load reads environment variables and initializes config
 func Load() {
@@ -27,10 +141,82 @@ func Load() {
 		SSLMode:  getEnv("DB_SSLMODE", "disable"),
 	}
 
+	Session = &SessionConfig{
+		TTL:          getEnvDuration("SESSION_TTL", 24*time.Hour),
+		IdleTimeout:  getEnvDuration("SESSION_IDLE_TIMEOUT", 30*time.Minute),
+		CookieSecure: getEnvBool("SESSION_COOKIE_SECURE", false),
+	}
+
+	Cache = &CacheConfig{
+		Size:        getEnvInt("REDIRECT_CACHE_SIZE", 10000),
+		TTL:         getEnvDuration("REDIRECT_CACHE_TTL", 5*time.Minute),
+		NegativeTTL: getEnvDuration("REDIRECT_CACHE_NEGATIVE_TTL", 30*time.Second),
+	}
+
+	RateLimit = &RateLimitConfig{
+		Store:           getEnv("RATE_LIMIT_STORE", "postgres"),
+		ShortenRequests: getEnvInt("SHORTEN_RATE_LIMIT", 10),
+		ShortenPeriod:   getEnvDuration("SHORTEN_RATE_PERIOD", time.Minute),
+		APIRequests:     getEnvInt("API_RATE_LIMIT", 120),
+		APIPeriod:       getEnvDuration("API_RATE_PERIOD", time.Minute),
+		UnlockRequests:  getEnvInt("UNLOCK_RATE_LIMIT", 5),
+		UnlockPeriod:    getEnvDuration("UNLOCK_RATE_PERIOD", 15*time.Minute),
+	}
+
+	Server = &ServerConfig{
+		TrustProxy:  getEnvBool("TRUST_PROXY", false),
+		ProxyHeader: getEnv("PROXY_HEADER", "X-Forwarded-For"),
+	}
+
+	URLPolicy = &URLPolicyConfig{
+		AllowedSchemes: getEnvList("URL_ALLOWED_SCHEMES", []string{"http", "https"}),
+		OwnHosts:       getEnvList("URL_OWN_HOSTS", []string{"onjourney.link"}),
+		BlocklistFile:  getEnv("URL_BLOCKLIST_FILE", ""),
+		AllowlistOnly:  getEnvBool("URL_ALLOWLIST_ONLY", false),
+	}
+
+	Bulk = &BulkConfig{
+		BatchMaxItems:         getEnvInt("LINK_BATCH_MAX_ITEMS", 100),
+		ImportMaxRows:         getEnvInt("LINK_IMPORT_MAX_ROWS", 10000),
+		ImportMaxPasswordRows: getEnvInt("LINK_IMPORT_MAX_PASSWORD_ROWS", 50),
+	}
+
+	Redirect = &RedirectConfig{
+		DefaultType:     getEnvInt("REDIRECT_DEFAULT_TYPE", 302),
+		PermanentMaxAge: getEnvDuration("REDIRECT_PERMANENT_MAX_AGE", 24*time.Hour),
+		UnlockTTL:       getEnvDuration("LINK_UNLOCK_TTL", time.Hour),
+	}
+	Preview = &PreviewConfig{
+		FetchTimeout: getEnvDuration("PREVIEW_FETCH_TIMEOUT", 3*time.Second),
+		CacheTTL:     getEnvDuration("PREVIEW_CACHE_TTL", time.Hour),
+		Countdown:    getEnvDuration("INTERSTITIAL_COUNTDOWN", 5*time.Second),
+	}
+
+	Sink = &SinkConfig{
+		FileDir: getEnv("FILE_SINK_DIR", ""),
+	}
+
+	switch Redirect.DefaultType {
+	case 301, 302, 307, 308:
+	default:
+		panic("REDIRECT_DEFAULT_TYPE must be one of 301, 302, 307 or 308")
+	}
+
 	// Validate required database config
 	if DB.Password == "" {
 		panic("DB_PASSWORD environment variable is required")
 	}
+
+	// Master key for secret fields, base64 of 32 random bytes
+	encryptionKey := getEnv("ENCRYPTION_KEY", "")
+	if encryptionKey == "" {
+		panic("ENCRYPTION_KEY environment variable is required")
+	}
+	masterKey, err := base64.StdEncoding.DecodeString(encryptionKey)
+	if err != nil || len(masterKey) != 32 {
+		panic("ENCRYPTION_KEY must be 32 bytes, base64 encoded (openssl rand -base64 32)")
+	}
+	Secrets = &SecretsConfig{MasterKey: masterKey}
 }
 
 // GetDSN returns PostgreSQL connection string
@@ -48,3 +234,48 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvDuration gets a duration environment variable (e.g. "30m") or returns default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+// getEnvInt gets an integer environment variable or returns default value
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+	}
+	return defaultValue
+}
+
+// getEnvBool gets a boolean environment variable or returns default value
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList reads a comma separated list, lowercased and without blanks
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     func(c *LRU[string, int])
+		present []string
+		evicted []string
+	}{
+		{
+			name: "oldest entry is evicted when full",
+			ops: func(c *LRU[string, int]) {
+				c.Set("a", 1, time.Hour)
+				c.Set("b", 2, time.Hour)
+				c.Set("c", 3, time.Hour)
+				c.Set("d", 4, time.Hour)
+			},
+			present: []string{"b", "c", "d"},
+			evicted: []string{"a"},
+		},
+		{
+			name: "get marks an entry as recently used",
+			ops: func(c *LRU[string, int]) {
+				c.Set("a", 1, time.Hour)
+				c.Set("b", 2, time.Hour)
+				c.Set("c", 3, time.Hour)
+				c.Get("a")
+				c.Set("d", 4, time.Hour)
+			},
+			present: []string{"a", "c", "d"},
+			evicted: []string{"b"},
+		},
+		{
+			name: "overwriting an entry marks it as recently used",
+			ops: func(c *LRU[string, int]) {
+				c.Set("a", 1, time.Hour)
+				c.Set("b", 2, time.Hour)
+				c.Set("c", 3, time.Hour)
+				c.Set("a", 10, time.Hour)
+				c.Set("d", 4, time.Hour)
+			},
+			present: []string{"a", "c", "d"},
+			evicted: []string{"b"},
+		},
+		{
+			name: "delete frees a slot",
+			ops: func(c *LRU[string, int]) {
+				c.Set("a", 1, time.Hour)
+				c.Set("b", 2, time.Hour)
+				c.Set("c", 3, time.Hour)
+				c.Delete("b")
+				c.Set("d", 4, time.Hour)
+			},
+			present: []string{"a", "c", "d"},
+			evicted: []string{"b"},
+		},
+		{
+			name: "purge removes everything",
+			ops: func(c *LRU[string, int]) {
+				c.Set("a", 1, time.Hour)
+				c.Set("b", 2, time.Hour)
+				c.Purge()
+			},
+			evicted: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewLRU[string, int](3)
+			tt.ops(c)
+
+			if c.Len() != len(tt.present) {
+				t.Errorf("Len() = %d, want %d", c.Len(), len(tt.present))
+			}
+			for _, key := range tt.present {
+				if _, ok := c.Get(key); !ok {
+					t.Errorf("Get(%q) missing, want present", key)
+				}
+			}
+			for _, key := range tt.evicted {
+				if _, ok := c.Get(key); ok {
+					t.Errorf("Get(%q) present, want evicted", key)
+				}
+			}
+		})
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		found bool
+	}{
+		{name: "live entry", ttl: time.Hour, found: true},
+		{name: "expired entry", ttl: -time.Second, found: false},
+		{name: "zero ttl expires immediately", ttl: 0, found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewLRU[string, int](3)
+			c.Set("a", 1, tt.ttl)
+
+			value, ok := c.Get("a")
+			if ok != tt.found {
+				t.Fatalf("Get() found = %v, want %v", ok, tt.found)
+			}
+			if ok && value != 1 {
+				t.Errorf("Get() = %d, want 1", value)
+			}
+			// Expired entries are dropped on read
+			if !tt.found && c.Len() != 0 {
+				t.Errorf("Len() = %d after reading an expired entry, want 0", c.Len())
+			}
+		})
+	}
+}
+
+func TestLRUOverwriteRefreshesTTL(t *testing.T) {
+	c := NewLRU[string, int](3)
+	c.Set("a", 1, -time.Second)
+	c.Set("a", 2, time.Hour)
+
+	if value, ok := c.Get("a"); !ok || value != 2 {
+		t.Errorf("Get() = %d, %v, want 2, true", value, ok)
+	}
+}
@@ -0,0 +1,33 @@
+package nullable
+
+import "encoding/json"
+
+// Value is an optional JSON field that tells an omitted field from an
+// explicit null: Set is false when the field was omitted, and Value is nil
+// when it was null. Updates use it for fields that can be cleared.
+type Value[T any] struct {
+	Set   bool
+	Value *T
+}
+
+// Of returns a Value set to value, nil for null
+func Of[T any](value *T) Value[T] {
+	return Value[T]{Set: true, Value: value}
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It is only called for fields
+// that are present, null included.
+func (v *Value[T]) UnmarshalJSON(data []byte) error {
+	v.Set = true
+	if string(data) == "null" {
+		v.Value = nil
+		return nil
+	}
+	v.Value = new(T)
+	return json.Unmarshal(data, v.Value)
+}
+
+// MarshalJSON implements json.Marshaler, writing null for unset values
+func (v Value[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.Value)
+}
@@ -0,0 +1,217 @@
+package problem
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+)
+
+// ContentType is the media type of error responses (RFC 7807)
+const ContentType = "application/problem+json"
+
+// Problem types. They are stable, so clients can match on them instead of
+// on the English detail message.
+const (
+	TypeInternal         = "internal_error"
+	TypeNotFound         = "not_found"
+	TypeHTTPError        = "http_error"
+	TypeInvalidBody      = "invalid_body"
+	TypeValidationFailed = "validation_failed"
+	TypeInvalidID        = "invalid_id"
+	TypeInvalidURL       = "invalid_url"
+
+	// URL policy rejections, see platform/urlpolicy
+	TypeURLSchemeNotAllowed = "url_scheme_not_allowed"
+	TypeURLCredentials      = "url_credentials_not_allowed"
+	TypeURLSelfReference    = "url_self_reference"
+	TypeURLDomainBlocked    = "url_domain_blocked"
+	TypeURLDomainNotAllowed = "url_domain_not_allowed"
+	TypeURLBlocklisted      = "url_blocklisted"
+
+	TypeUnauthorized       = "unauthorized"
+	TypeInvalidCredentials = "invalid_credentials"
+	TypeForbidden          = "forbidden"
+	TypeTokenMissing       = "token_missing"
+	TypeTokenInvalid       = "token_invalid"
+	TypeTokenExpired       = "token_expired"
+	TypeTokenRevoked       = "token_revoked"
+	TypeInsufficientScope  = "insufficient_scope"
+	TypeRateLimited        = "rate_limited"
+	TypeQuotaExceeded      = "quota_exceeded"
+	TypeCodeTaken          = "code_taken"
+	TypeUsernameTaken      = "username_taken"
+	TypeRuleExists         = "rule_exists"
+	TypeDomainExists       = "domain_exists"
+	TypeDomainInUse        = "domain_in_use"
+	TypeLinkNotFound       = "link_not_found"
+	TypeTokenNotFound      = "token_not_found"
+	TypeUserNotFound       = "user_not_found"
+	TypeEventNotFound      = "event_not_found"
+	TypeRuleNotFound       = "rule_not_found"
+	TypeDomainNotFound     = "domain_not_found"
+	TypeSinkUnreachable    = "sink_unreachable"
+
+	TypeInvalidIdempotencyKey = "invalid_idempotency_key"
+	TypeIdempotencyKeyReused  = "idempotency_key_reused"
+	TypeIdempotencyKeyInUse   = "idempotency_key_in_use"
+	TypeImportInvalid         = "import_invalid"
+)
+
+// titles are the short summaries of the problem types; types without one
+// use the HTTP status text
+var titles = map[string]string{
+	TypeInternal:              "Internal server error",
+	TypeInvalidBody:           "Invalid request body",
+	TypeValidationFailed:      "Validation failed",
+	TypeInvalidID:             "Invalid ID",
+	TypeInvalidURL:            "Invalid URL",
+	TypeURLSchemeNotAllowed:   "URL scheme not allowed",
+	TypeURLCredentials:        "URL credentials not allowed",
+	TypeURLSelfReference:      "URL points to this shortener",
+	TypeURLDomainBlocked:      "Domain blocked",
+	TypeURLDomainNotAllowed:   "Domain not on the allow list",
+	TypeURLBlocklisted:        "URL listed as phishing or malware",
+	TypeUnauthorized:          "Authentication required",
+	TypeInvalidCredentials:    "Invalid credentials",
+	TypeForbidden:             "Forbidden",
+	TypeTokenMissing:          "API token required",
+	TypeTokenInvalid:          "Invalid API token",
+	TypeTokenExpired:          "API token expired",
+	TypeTokenRevoked:          "API token revoked",
+	TypeInsufficientScope:     "Insufficient scope",
+	TypeRateLimited:           "Too many requests",
+	TypeQuotaExceeded:         "Link quota exceeded",
+	TypeCodeTaken:             "Code already taken",
+	TypeUsernameTaken:         "Username already taken",
+	TypeRuleExists:            "Domain rule already exists",
+	TypeDomainExists:          "Domain already exists",
+	TypeDomainInUse:           "Domain in use",
+	TypeLinkNotFound:          "Link not found",
+	TypeTokenNotFound:         "Token not found",
+	TypeUserNotFound:          "User not found",
+	TypeEventNotFound:         "Event not found",
+	TypeRuleNotFound:          "Domain rule not found",
+	TypeDomainNotFound:        "Domain not found",
+	TypeSinkUnreachable:       "Event sink unreachable",
+	TypeInvalidIdempotencyKey: "Invalid Idempotency-Key",
+	TypeIdempotencyKeyReused:  "Idempotency-Key reused",
+	TypeIdempotencyKeyInUse:   "Idempotency-Key in use",
+	TypeImportInvalid:         "Import has invalid rows",
+}
+
+// Problem is an error response. Handlers return it as their error and
+// Handler writes it as application/problem+json. The cause is only logged.
+type Problem struct {
+	Status     int
+	Type       string
+	Detail     string
+	Extensions map[string]any
+	cause      error
+}
+
+// New creates a problem with an HTTP status, a type and a detail message
+func New(status int, typ, detail string) *Problem {
+	return &Problem{Status: status, Type: typ, Detail: detail}
+}
+
+// Internal creates a 500 problem. detail is shown to the client, cause is logged.
+func Internal(detail string, cause error) *Problem {
+	return New(http.StatusInternalServerError, TypeInternal, detail).Wrap(cause)
+}
+
+// Wrap records the underlying error, logged when the problem is handled
+func (p *Problem) Wrap(cause error) *Problem {
+	p.cause = cause
+	return p
+}
+
+// With adds an extension member to the response body
+func (p *Problem) With(key string, value any) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]any)
+	}
+	p.Extensions[key] = value
+	return p
+}
+
+func (p *Problem) Error() string {
+	if p.cause != nil {
+		return p.Type + ": " + p.Detail + ": " + p.cause.Error()
+	}
+	return p.Type + ": " + p.Detail
+}
+
+func (p *Problem) Unwrap() error {
+	return p.cause
+}
+
+// Handler is the app's fiber.ErrorHandler. Problems are written as they are,
+// Fiber errors (unknown routes, oversized bodies, ...) keep their status, and
+// any other error becomes a 500. Server errors and wrapped causes are logged
+// with the request ID, which is also returned to the client.
+func Handler(c fiber.Ctx, err error) error {
+	p := From(err)
+	Log(c, p)
+
+	body := p.Body()
+	body["instance"] = c.Path()
+	body["request_id"] = requestid.FromContext(c)
+
+	return c.Status(p.Status).JSON(body, ContentType)
+}
+
+// From returns err as a problem: problems as they are, Fiber errors with
+// their status and anything else as a 500
+func From(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return New(fiberErr.Code, typeForStatus(fiberErr.Code), fiberErr.Message)
+	}
+	return Internal("Internal server error", err)
+}
+
+// Log logs server errors and problems with a wrapped cause, tagged with the
+// request ID. Handler calls it; handlers that report problems inside a
+// successful response (e.g. per-item batch results) call it themselves.
+func Log(c fiber.Ctx, p *Problem) {
+	if p.cause != nil || p.Status >= http.StatusInternalServerError {
+		log.Printf("[%s] %s %s: %d %s", requestid.FromContext(c), c.Method(), c.Path(), p.Status, p.Error())
+	}
+}
+
+// Body returns the members of the problem's JSON representation, without
+// the request specific instance and request_id
+func (p *Problem) Body() fiber.Map {
+	title, ok := titles[p.Type]
+	if !ok {
+		title = http.StatusText(p.Status)
+	}
+
+	body := fiber.Map{}
+	for key, value := range p.Extensions {
+		body[key] = value
+	}
+	body["type"] = p.Type
+	body["title"] = title
+	body["status"] = p.Status
+	body["detail"] = p.Detail
+	return body
+}
+
+// typeForStatus picks a type for errors raised by Fiber itself
+func typeForStatus(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return TypeNotFound
+	case http.StatusInternalServerError:
+		return TypeInternal
+	}
+	return TypeHTTPError
+}
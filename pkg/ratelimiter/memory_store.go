@@ -0,0 +1,92 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps rate limit state in process memory. It is only correct for
+// a single process: prefork children and other instances each have their own.
+type MemoryStore struct {
+	mu          sync.Mutex
+	lastPublish map[string]time.Time
+	buckets     map[string]time.Time // key -> theoretical arrival time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		lastPublish: make(map[string]time.Time),
+		buckets:     make(map[string]time.Time),
+	}
+}
+
+// Acquire implements Store
+func (s *MemoryStore) Acquire(ctx context.Context, key string, window time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if last, exists := s.lastPublish[key]; exists && now.Sub(last) < window {
+		return false, nil
+	}
+	s.lastPublish[key] = now
+	return true, nil
+}
+
+// Take implements Store
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	tat := s.buckets[key]
+	if tat.Before(now) {
+		tat = now
+	}
+
+	next := tat.Add(limit.interval())
+	if next.Sub(now) > limit.Period {
+		return newResult(false, limit, tat, now), nil
+	}
+	s.buckets[key] = next
+	return newResult(true, limit, next, now), nil
+}
+
+// Refund implements Store
+func (s *MemoryStore) Refund(ctx context.Context, key string, limit Limit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tat, ok := s.buckets[key]
+	if !ok {
+		return nil
+	}
+	tat = tat.Add(-limit.interval())
+	if tat.After(time.Now()) {
+		s.buckets[key] = tat
+	} else {
+		// A full bucket
+		delete(s.buckets, key)
+	}
+	return nil
+}
+
+// Cleanup implements Store
+func (s *MemoryStore) Cleanup(ctx context.Context, olderThan time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, last := range s.lastPublish {
+		if last.Before(olderThan) {
+			delete(s.lastPublish, key)
+		}
+	}
+	for key, tat := range s.buckets {
+		if tat.Before(olderThan) {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNewResult(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limit := Limit{Requests: 4, Period: time.Hour} // a token every 15 minutes
+
+	tests := []struct {
+		name    string
+		allowed bool
+		tat     time.Time
+		want    Result
+	}{
+		{
+			name:    "full bucket",
+			allowed: true,
+			tat:     now,
+			want:    Result{Allowed: true, Limit: 4, Remaining: 4},
+		},
+		{
+			name:    "tat in the past counts as full",
+			allowed: true,
+			tat:     now.Add(-time.Hour),
+			want:    Result{Allowed: true, Limit: 4, Remaining: 4},
+		},
+		{
+			name:    "one token taken",
+			allowed: true,
+			tat:     now.Add(15 * time.Minute),
+			want:    Result{Allowed: true, Limit: 4, Remaining: 3, Reset: 15 * time.Minute},
+		},
+		{
+			name:    "partly refilled token is not counted",
+			allowed: true,
+			tat:     now.Add(20 * time.Minute),
+			want:    Result{Allowed: true, Limit: 4, Remaining: 2, Reset: 20 * time.Minute},
+		},
+		{
+			name:    "empty bucket",
+			allowed: true,
+			tat:     now.Add(time.Hour),
+			want:    Result{Allowed: true, Limit: 4, Remaining: 0, Reset: time.Hour},
+		},
+		{
+			name:    "denied waits for the next token",
+			allowed: false,
+			tat:     now.Add(time.Hour),
+			want:    Result{Allowed: false, Limit: 4, Remaining: 0, RetryAfter: 15 * time.Minute, Reset: time.Hour},
+		},
+		{
+			name:    "denied with a token partly refilled",
+			allowed: false,
+			tat:     now.Add(50 * time.Minute),
+			want:    Result{Allowed: false, Limit: 4, Remaining: 0, RetryAfter: 5 * time.Minute, Reset: 50 * time.Minute},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newResult(tt.allowed, limit, tt.tat, now)
+			if got != tt.want {
+				t.Errorf("newResult() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit Limit
+		takes int
+		// allowed is the number of takes expected to pass before the first denial
+		allowed int
+	}{
+		{name: "burst of one", limit: Limit{Requests: 1, Period: time.Hour}, takes: 3, allowed: 1},
+		{name: "burst of three", limit: Limit{Requests: 3, Period: time.Hour}, takes: 5, allowed: 3},
+		{name: "within the burst", limit: Limit{Requests: 10, Period: time.Hour}, takes: 4, allowed: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			ctx := context.Background()
+
+			for i := 0; i < tt.takes; i++ {
+				result, err := store.Take(ctx, "key", tt.limit)
+				if err != nil {
+					t.Fatalf("Take() error = %v", err)
+				}
+
+				wantAllowed := i < tt.allowed
+				if result.Allowed != wantAllowed {
+					t.Fatalf("take %d: Allowed = %v, want %v", i+1, result.Allowed, wantAllowed)
+				}
+				if wantAllowed {
+					if want := tt.limit.Requests - i - 1; result.Remaining != want {
+						t.Errorf("take %d: Remaining = %d, want %d", i+1, result.Remaining, want)
+					}
+					continue
+				}
+				// The next token arrives one interval after the bucket ran empty
+				if interval := tt.limit.interval(); result.RetryAfter <= 0 || result.RetryAfter > interval {
+					t.Errorf("take %d: RetryAfter = %v, want in (0, %v]", i+1, result.RetryAfter, interval)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreKeysAreSeparate(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	limit := Limit{Requests: 1, Period: time.Hour}
+
+	for _, key := range []string{"a", "b"} {
+		result, err := store.Take(ctx, key, limit)
+		if err != nil || !result.Allowed {
+			t.Errorf("Take(%q) = %+v, %v, want allowed", key, result, err)
+		}
+	}
+}
+
+func TestMemoryStoreRefund(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	limit := Limit{Requests: 2, Period: time.Hour}
+
+	tests := []struct {
+		name      string
+		key       string
+		refund    bool
+		allowed   bool
+		remaining int
+	}{
+		{name: "take", key: "a", allowed: true, remaining: 1},
+		{name: "refund", key: "a", refund: true},
+		{name: "take after a refund", key: "a", allowed: true, remaining: 1},
+		{name: "take the last token", key: "a", allowed: true, remaining: 0},
+		{name: "take from an empty bucket", key: "a", allowed: false, remaining: 0},
+		{name: "refund on an empty bucket", key: "a", refund: true},
+		{name: "take the refunded token", key: "a", allowed: true, remaining: 0},
+		{name: "refund on a full bucket", key: "b", refund: true},
+		{name: "full bucket doesn't grow", key: "b", allowed: true, remaining: 1},
+		{name: "refund to full", key: "b", refund: true},
+		{name: "refund beyond full", key: "b", refund: true},
+		{name: "take after refunds", key: "b", allowed: true, remaining: 1},
+	}
+
+	for _, tt := range tests {
+		if tt.refund {
+			if err := store.Refund(ctx, tt.key, limit); err != nil {
+				t.Fatalf("%s: error = %v", tt.name, err)
+			}
+			continue
+		}
+
+		result, err := store.Take(ctx, tt.key, limit)
+		if err != nil {
+			t.Fatalf("%s: error = %v", tt.name, err)
+		}
+		if result.Allowed != tt.allowed || result.Remaining != tt.remaining {
+			t.Errorf("%s: Allowed = %v, Remaining = %d, want %v, %d",
+				tt.name, result.Allowed, result.Remaining, tt.allowed, tt.remaining)
+		}
+	}
+}
+
+func TestMemoryStoreAcquire(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		key    string
+		window time.Duration
+		want   bool
+	}{
+		{name: "first publish", key: "a", window: time.Hour, want: true},
+		{name: "within the window", key: "a", window: time.Hour, want: false},
+		{name: "other session", key: "b", window: time.Hour, want: true},
+		{name: "window passed", key: "a", window: 0, want: true},
+	}
+
+	for _, tt := range tests {
+		got, err := store.Acquire(ctx, tt.key, tt.window)
+		if err != nil {
+			t.Fatalf("%s: error = %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: Acquire() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PostgresStore shares rate limit state between all processes and instances
+// through an UNLOGGED table: it skips the WAL, which is fine for state that
+// may be lost on a database crash.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+// NewPostgresStore creates the rate_limits and rate_limit_buckets tables if needed
+func NewPostgresStore(db *gorm.DB) (*PostgresStore, error) {
+	statements := []string{
+		`CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (
+			key varchar(64) PRIMARY KEY,
+			last_publish_at timestamptz NOT NULL
+		)`,
+		`CREATE UNLOGGED TABLE IF NOT EXISTS rate_limit_buckets (
+			key varchar(128) PRIMARY KEY,
+			tat timestamptz NOT NULL
+		)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+// Acquire implements Store. The upsert only overwrites rows whose window has
+// passed, and the row lock taken by ON CONFLICT serializes concurrent callers,
+// so exactly one of them sees a row affected. Database time is used so clock
+// skew between instances doesn't matter.
+func (s *PostgresStore) Acquire(ctx context.Context, key string, window time.Duration) (bool, error) {
+	result := s.db.WithContext(ctx).Exec(`
+		INSERT INTO rate_limits (key, last_publish_at) VALUES (?, now())
+		ON CONFLICT (key) DO UPDATE SET last_publish_at = EXCLUDED.last_publish_at
+		WHERE rate_limits.last_publish_at <= EXCLUDED.last_publish_at - make_interval(secs => ?)`,
+		key, window.Seconds())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// bucketRow is the state of a bucket as seen by the database
+type bucketRow struct {
+	Tat time.Time
+	Now time.Time
+}
+
+// Take implements Store with GCRA: each bucket is a single "theoretical
+// arrival time" that advances by one interval per request and may run at
+// most Period ahead of now. The upsert only advances it when that holds.
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	interval := limit.interval().Seconds()
+	period := limit.Period.Seconds()
+
+	var row bucketRow
+	result := s.db.WithContext(ctx).Raw(`
+		INSERT INTO rate_limit_buckets AS b (key, tat) VALUES (?, now() + make_interval(secs => ?))
+		ON CONFLICT (key) DO UPDATE SET tat = GREATEST(b.tat, now()) + make_interval(secs => ?)
+		WHERE GREATEST(b.tat, now()) + make_interval(secs => ?) - now() <= make_interval(secs => ?)
+		RETURNING tat, now() AS now`,
+		key, interval, interval, interval, period).Scan(&row)
+	if result.Error != nil {
+		return Result{}, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return newResult(true, limit, row.Tat, row.Now), nil
+	}
+
+	// Denied: read the bucket to tell the client when to retry
+	err := s.db.WithContext(ctx).Raw(
+		"SELECT GREATEST(tat, now()) AS tat, now() AS now FROM rate_limit_buckets WHERE key = ?", key,
+	).Scan(&row).Error
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(false, limit, row.Tat, row.Now), nil
+}
+
+// Refund implements Store. The bucket never goes back further than full.
+func (s *PostgresStore) Refund(ctx context.Context, key string, limit Limit) error {
+	return s.db.WithContext(ctx).Exec(
+		"UPDATE rate_limit_buckets SET tat = GREATEST(tat - make_interval(secs => ?), now()) WHERE key = ?",
+		limit.interval().Seconds(), key,
+	).Error
+}
+
+// Cleanup implements Store
+func (s *PostgresStore) Cleanup(ctx context.Context, olderThan time.Time) error {
+	if err := s.db.WithContext(ctx).Exec("DELETE FROM rate_limits WHERE last_publish_at < ?", olderThan).Error; err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Exec("DELETE FROM rate_limit_buckets WHERE tat < ?", olderThan).Error
+}
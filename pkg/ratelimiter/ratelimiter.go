@@ -1,20 +1,92 @@
 package ratelimiter
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
-	"sync"
+	"log"
 	"time"
 )
 
-// RateLimiter handles rate limiting for click events
+// entryMaxAge is how long a session's last publish time is kept
+const entryMaxAge = 24 * time.Hour
+
+// Store keeps rate limit state: the last publish time per click session and
+// the token buckets of request limits. Implementations must make Acquire and
+// Take atomic so concurrent processes never both win the same slot.
+type Store interface {
+	// Acquire records a publish for key and returns true if the previous
+	// publish was at least window ago; otherwise it records nothing
+	Acquire(ctx context.Context, key string, window time.Duration) (bool, error)
+	// Take removes one token from the bucket for key, see Limit
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	// Refund puts back a token removed by Take, for limits that only count
+	// failed attempts
+	Refund(ctx context.Context, key string, limit Limit) error
+	// Cleanup removes entries last used before olderThan
+	Cleanup(ctx context.Context, olderThan time.Time) error
+}
+
+// Limit is a token bucket holding up to Requests tokens, refilled evenly over
+// Period. A client can burst Requests calls, then sustain Requests per Period.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// interval is the time it takes to refill one token
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// Result describes the state of a bucket after Take
+type Result struct {
+	Allowed bool
+	// Limit is the bucket size
+	Limit int
+	// Remaining is the number of tokens left
+	Remaining int
+	// RetryAfter is how long to wait for the next token when not allowed
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// newResult derives a Result from a bucket's theoretical arrival time (GCRA):
+// the bucket is empty once tat is Period ahead of now, and full once tat <= now
+func newResult(allowed bool, limit Limit, tat, now time.Time) Result {
+	ahead := tat.Sub(now)
+	if ahead < 0 {
+		ahead = 0
+	}
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: int((limit.Period - ahead) / limit.interval()),
+		Reset:     ahead,
+	}
+	if !allowed {
+		result.RetryAfter = ahead + limit.interval() - limit.Period
+	}
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	return result
+}
+
+// RateLimiter handles rate limiting for click events and API requests
 type RateLimiter struct {
-	store sync.Map // map[sessionKey]lastPublishTime (Unix seconds)
+	store Store
 }
 
-// NewRateLimiter creates a new rate limiter instance
+// NewRateLimiter creates a rate limiter backed by an in-process store
 func NewRateLimiter() *RateLimiter {
-	rl := &RateLimiter{}
+	return New(NewMemoryStore())
+}
+
+// New creates a rate limiter backed by the given store
+func New(store Store) *RateLimiter {
+	rl := &RateLimiter{store: store}
 	// Start cleanup goroutine
 	go rl.cleanup()
 	return rl
@@ -27,50 +99,57 @@ func GetSessionKey(ip, userAgent string) string {
 	return fmt.Sprintf("%x", hash)
 }
 
-// ShouldAllowPublish checks if publishing is allowed for the given session
-func (rl *RateLimiter) ShouldAllowPublish(sessionKey string, rateLimitSeconds int) bool {
-	now := time.Now().Unix()
-	
-	value, exists := rl.store.Load(sessionKey)
-	if !exists {
+// Allow checks and records a publish for the session in one step. It returns
+// false if the session already published within rateLimitSeconds. When the
+// store fails the publish is allowed, so clicks are not silently dropped.
+func (rl *RateLimiter) Allow(sessionKey string, rateLimitSeconds int) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	allowed, err := rl.store.Acquire(ctx, sessionKey, time.Duration(rateLimitSeconds)*time.Second)
+	if err != nil {
+		log.Printf("Rate limiter store failed, allowing publish: %v", err)
 		return true
 	}
-	
-	lastPublishTime, ok := value.(int64)
-	if !ok {
-		return true
+	return allowed
+}
+
+// Take consumes a request from the bucket for key. When the store fails the
+// request is allowed, so an outage of the store doesn't take the API down.
+func (rl *RateLimiter) Take(key string, limit Limit) Result {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	result, err := rl.store.Take(ctx, key, limit)
+	if err != nil {
+		log.Printf("Rate limiter store failed, allowing request: %v", err)
+		return Result{Allowed: true, Limit: limit.Requests, Remaining: limit.Requests}
 	}
-	
-	elapsed := now - lastPublishTime
-	return elapsed >= int64(rateLimitSeconds)
+	return result
 }
 
-// RecordPublish records the publish time for a session
-func (rl *RateLimiter) RecordPublish(sessionKey string) {
-	now := time.Now().Unix()
-	rl.store.Store(sessionKey, now)
+// Refund gives back the token of an attempt that turned out not to count,
+// e.g. a correct password. Taking first and refunding afterwards keeps
+// concurrent attempts from all getting through before any is charged.
+func (rl *RateLimiter) Refund(key string, limit Limit) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := rl.store.Refund(ctx, key, limit); err != nil {
+		log.Printf("Failed to refund rate limit token: %v", err)
+	}
 }
 
-// cleanup removes old entries to prevent memory leaks
+// cleanup removes old entries to prevent unbounded growth
 func (rl *RateLimiter) cleanup() {
 	ticker := time.NewTicker(1 * time.Hour)
 	defer ticker.Stop()
-	
+
 	for range ticker.C {
-		now := time.Now().Unix()
-		rl.store.Range(func(key, value interface{}) bool {
-			lastPublishTime, ok := value.(int64)
-			if !ok {
-				rl.store.Delete(key)
-				return true
-			}
-			
-			// Delete entries older than 24 hours
-			if now-lastPublishTime > 86400 {
-				rl.store.Delete(key)
-			}
-			return true
-		})
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err := rl.store.Cleanup(ctx, time.Now().Add(-entryMaxAge)); err != nil {
+			log.Printf("Failed to clean up rate limiter store: %v", err)
+		}
+		cancel()
 	}
 }
-
@@ -0,0 +1,101 @@
+package rbac
+
+// Admin user roles, from most to least privileged
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// Permissions checked on admin routes and views
+const (
+	LinksRead    = "links:read"
+	LinksWrite   = "links:write"
+	TokensRead   = "tokens:read"
+	TokensWrite  = "tokens:write"
+	EventsRead   = "events:read"
+	EventsWrite  = "events:write"
+	UsersRead    = "users:read"
+	UsersWrite   = "users:write"
+	PolicyRead   = "policy:read"
+	PolicyWrite  = "policy:write"
+	DomainsRead  = "domains:read"
+	DomainsWrite = "domains:write"
+)
+
+// Roles lists every role, from most to least privileged
+var Roles = []string{RoleOwner, RoleAdmin, RoleEditor, RoleViewer}
+
+// Permissions lists every permission
+var Permissions = []string{
+	LinksRead, LinksWrite,
+	TokensRead, TokensWrite,
+	EventsRead, EventsWrite,
+	UsersRead, UsersWrite,
+	PolicyRead, PolicyWrite,
+	DomainsRead, DomainsWrite,
+}
+
+// rolePermissions maps each role to the permissions it grants
+var rolePermissions = map[string]map[string]bool{
+	RoleOwner: set(Permissions...),
+	RoleAdmin: set(Permissions...),
+	RoleEditor: set(
+		LinksRead, LinksWrite,
+		DomainsRead,
+	),
+	RoleViewer: set(
+		LinksRead,
+		DomainsRead,
+	),
+}
+
+// roleRank orders roles so a user can only manage users ranked below them
+var roleRank = map[string]int{
+	RoleOwner:  4,
+	RoleAdmin:  3,
+	RoleEditor: 2,
+	RoleViewer: 1,
+}
+
+func set(permissions ...string) map[string]bool {
+	m := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		m[p] = true
+	}
+	return m
+}
+
+// IsValidRole reports whether role is a known role
+func IsValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// Can reports whether the role grants the permission
+func Can(role, permission string) bool {
+	return rolePermissions[role][permission]
+}
+
+// PermissionsFor returns every permission with whether the role grants it,
+// ready to be passed to templates
+func PermissionsFor(role string) map[string]bool {
+	m := make(map[string]bool, len(Permissions))
+	for _, p := range Permissions {
+		m[p] = Can(role, p)
+	}
+	return m
+}
+
+// CanManage reports whether a user with actorRole may create, edit or delete a
+// user with targetRole. Owners manage everyone, others only lower ranked roles.
+func CanManage(actorRole, targetRole string) bool {
+	if !Can(actorRole, UsersWrite) {
+		return false
+	}
+	if actorRole == RoleOwner {
+		return true
+	}
+	return roleRank[actorRole] > roleRank[targetRole]
+}
@@ -0,0 +1,62 @@
+package rbac
+
+import "testing"
+
+func TestCanManage(t *testing.T) {
+	tests := []struct {
+		actor  string
+		target string
+		want   bool
+	}{
+		{actor: RoleOwner, target: RoleOwner, want: true},
+		{actor: RoleOwner, target: RoleAdmin, want: true},
+		{actor: RoleOwner, target: RoleEditor, want: true},
+		{actor: RoleOwner, target: RoleViewer, want: true},
+
+		{actor: RoleAdmin, target: RoleOwner, want: false},
+		{actor: RoleAdmin, target: RoleAdmin, want: false},
+		{actor: RoleAdmin, target: RoleEditor, want: true},
+		{actor: RoleAdmin, target: RoleViewer, want: true},
+
+		// Without users:write nobody can be managed, not even lower roles
+		{actor: RoleEditor, target: RoleViewer, want: false},
+		{actor: RoleEditor, target: RoleEditor, want: false},
+		{actor: RoleViewer, target: RoleViewer, want: false},
+
+		{actor: "", target: RoleViewer, want: false},
+		{actor: "unknown", target: RoleViewer, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.actor+"/"+tt.target, func(t *testing.T) {
+			if got := CanManage(tt.actor, tt.target); got != tt.want {
+				t.Errorf("CanManage(%q, %q) = %v, want %v", tt.actor, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		role       string
+		permission string
+		want       bool
+	}{
+		{role: RoleOwner, permission: UsersWrite, want: true},
+		{role: RoleAdmin, permission: PolicyWrite, want: true},
+		{role: RoleEditor, permission: LinksWrite, want: true},
+		{role: RoleEditor, permission: DomainsWrite, want: false},
+		{role: RoleEditor, permission: TokensRead, want: false},
+		{role: RoleViewer, permission: LinksRead, want: true},
+		{role: RoleViewer, permission: LinksWrite, want: false},
+		{role: "unknown", permission: LinksRead, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role+"/"+tt.permission, func(t *testing.T) {
+			if got := Can(tt.role, tt.permission); got != tt.want {
+				t.Errorf("Can(%q, %q) = %v, want %v", tt.role, tt.permission, got, tt.want)
+			}
+		})
+	}
+}
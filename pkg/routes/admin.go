@@ -3,42 +3,78 @@ package routes
 import (
 	"boilerplate/app/controllers"
 	"boilerplate/app/middleware"
+	"boilerplate/pkg/rbac"
 
 	"github.com/gofiber/fiber/v3"
 )
 
+// can is a shorthand for the permission middleware
+var can = middleware.RequirePermission
+
 // SetupAdmin registers admin routes
 func SetupAdmin(app *fiber.App) {
 	// Admin UI routes (require authentication)
 	admin := app.Group("/admin", middleware.RequireAdminAuth)
 	admin.Get("/", controllers.Dashboard)
-	admin.Get("/links", controllers.LinksPage)
-	admin.Get("/tokens", controllers.TokensPage)
-	admin.Get("/users", controllers.UsersPage)
-	
+	admin.Get("/links", can(rbac.LinksRead), controllers.LinksPage)
+	admin.Get("/tokens", can(rbac.TokensRead), controllers.TokensPage)
+	admin.Get("/users", can(rbac.UsersRead), controllers.UsersPage)
+	admin.Get("/events", can(rbac.EventsRead), controllers.EventsPage)
+	admin.Get("/policy", can(rbac.PolicyRead), controllers.PolicyPage)
+	admin.Get("/domains", can(rbac.DomainsRead), controllers.DomainsPage)
+	admin.Get("/account", controllers.AccountPage)
+
 	// Admin API routes (require authentication)
 	adminAPI := app.Group("/api/v1/admin", middleware.RequireAdminAuth)
-	
+
 	// Links management
 	linksAPI := adminAPI.Group("/links")
-	linksAPI.Get("/", controllers.ListLinks)
-	linksAPI.Post("/", controllers.CreateLink)
-	linksAPI.Put("/:code", controllers.UpdateLink)
-	linksAPI.Delete("/:code", controllers.DeleteLink)
-	
+	linksAPI.Get("/", can(rbac.LinksRead), controllers.ListLinks)
+	linksAPI.Post("/", can(rbac.LinksWrite), controllers.CreateLink)
+	linksAPI.Post("/import", can(rbac.LinksWrite), controllers.ImportLinks)
+	linksAPI.Get("/export", can(rbac.LinksRead), controllers.ExportLinks)
+	linksAPI.Put("/:code", can(rbac.LinksWrite), controllers.UpdateLink)
+	linksAPI.Delete("/:code", can(rbac.LinksWrite), controllers.DeleteLink)
+	linksAPI.Get("/:code/stats", can(rbac.LinksRead), controllers.GetLinkStats)
+
 	// API tokens management
 	tokensAPI := adminAPI.Group("/tokens")
-	tokensAPI.Get("/", controllers.ListTokens)
-	tokensAPI.Post("/", controllers.CreateToken)
-	tokensAPI.Put("/:id", controllers.UpdateToken)
-	tokensAPI.Delete("/:id", controllers.DeleteToken)
+	tokensAPI.Get("/", can(rbac.TokensRead), controllers.ListTokens)
+	tokensAPI.Post("/", can(rbac.TokensWrite), controllers.CreateToken)
+	tokensAPI.Put("/:id", can(rbac.TokensWrite), controllers.UpdateToken)
+	tokensAPI.Post("/:id/rotate", can(rbac.TokensWrite), controllers.RotateToken)
+	tokensAPI.Post("/:id/revoke", can(rbac.TokensWrite), controllers.RevokeToken)
+	tokensAPI.Post("/:id/test", can(rbac.TokensWrite), controllers.TestTokenConnection)
+	tokensAPI.Delete("/:id", can(rbac.TokensWrite), controllers.DeleteToken)
+
+	// Click event outbox (delivery status & dead-letter)
+	eventsAPI := adminAPI.Group("/events")
+	eventsAPI.Get("/", can(rbac.EventsRead), controllers.ListOutboxEvents)
+	eventsAPI.Post("/:id/retry", can(rbac.EventsWrite), controllers.RetryOutboxEvent)
+
+	// URL policy (domain block/allow rules, blocklist status, URL check)
+	policyAPI := adminAPI.Group("/policy")
+	policyAPI.Get("/", can(rbac.PolicyRead), controllers.GetURLPolicy)
+	policyAPI.Get("/check", can(rbac.PolicyRead), controllers.CheckURLPolicy)
+	policyAPI.Post("/rules", can(rbac.PolicyWrite), controllers.CreateDomainRule)
+	policyAPI.Delete("/rules/:id", can(rbac.PolicyWrite), controllers.DeleteDomainRule)
+
+	// Short domains, each with its own code namespace
+	domainsAPI := adminAPI.Group("/domains")
+	domainsAPI.Get("/", can(rbac.DomainsRead), controllers.ListDomains)
+	domainsAPI.Post("/", can(rbac.DomainsWrite), controllers.CreateDomain)
+	domainsAPI.Put("/:id", can(rbac.DomainsWrite), controllers.UpdateDomain)
+	domainsAPI.Delete("/:id", can(rbac.DomainsWrite), controllers.DeleteDomain)
+
+	// Own account, open to every role
+	adminAPI.Put("/account/password", controllers.ChangeOwnPassword)
 
 	// Admin users management
 	usersAPI := adminAPI.Group("/users")
-	usersAPI.Get("/", controllers.ListAdminUsers)
-	usersAPI.Post("/", controllers.CreateAdminUser)
-	usersAPI.Put("/:id", controllers.UpdateAdminUser)
-	usersAPI.Delete("/:id", controllers.DeleteAdminUser)
+	usersAPI.Get("/", can(rbac.UsersRead), controllers.ListAdminUsers)
+	usersAPI.Post("/", can(rbac.UsersWrite), controllers.CreateAdminUser)
+	usersAPI.Put("/:id", can(rbac.UsersWrite), controllers.UpdateAdminUser)
+	usersAPI.Delete("/:id", can(rbac.UsersWrite), controllers.DeleteAdminUser)
 }
 
 // SetupAuth registers authentication routes (public)
@@ -46,7 +82,7 @@ func SetupAuth(app *fiber.App) {
 	auth := app.Group("/admin")
 	auth.Post("/login", controllers.Login)
 	auth.Post("/logout", controllers.Logout)
-	
+
 	// Login page (public)
 	app.Get("/admin/login", func(c fiber.Ctx) error {
 		return c.Render("admin/login", fiber.Map{
@@ -54,4 +90,3 @@ func SetupAuth(app *fiber.App) {
 		})
 	})
 }
-
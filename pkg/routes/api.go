@@ -3,16 +3,34 @@ package routes
 import (
 	"boilerplate/app/controllers"
 	"boilerplate/app/middleware"
+	"boilerplate/config"
+	"boilerplate/pkg/ratelimiter"
+	"boilerplate/pkg/scopes"
 
 	"github.com/gofiber/fiber/v3"
 )
 
-// SetupAPI registers API routes
-func SetupAPI(app *fiber.App) {
+// scope is a shorthand for the API token scope middleware
+var scope = middleware.RequireScope
+
+// SetupAPI registers API routes, throttled per API token by limiter
+func SetupAPI(app *fiber.App, limiter *ratelimiter.RateLimiter) {
 	v1 := app.Group("/api/v1")
 	
-	// Link creation endpoint (requires API token)
-	links := v1.Group("/links", middleware.RequireAPIToken)
-	links.Post("/", controllers.CreateShortLink)
+	// Link endpoints (require API token, scoped to the token's own links)
+	links := v1.Group("/links", middleware.RequireAPIToken, middleware.RateLimitByToken(limiter, ratelimiter.Limit{
+		Requests: config.RateLimit.APIRequests,
+		Period:   config.RateLimit.APIPeriod,
+	}))
+	// Creates can be retried safely with an Idempotency-Key header
+	idempotency := middleware.Idempotency()
+
+	links.Get("/", scope(scopes.LinksRead), controllers.ListShortLinks)
+	links.Post("/", scope(scopes.LinksCreate), idempotency, controllers.CreateShortLink)
+	links.Post("/batch", scope(scopes.LinksCreate), idempotency, controllers.CreateShortLinkBatch)
+	links.Get("/:code", scope(scopes.LinksRead), controllers.GetShortLink)
+	links.Put("/:code", scope(scopes.LinksWrite), controllers.UpdateShortLink)
+	links.Delete("/:code", scope(scopes.LinksWrite), controllers.DeleteShortLink)
+	links.Get("/:code/stats", scope(scopes.StatsRead), controllers.GetShortLinkStats)
 }
 
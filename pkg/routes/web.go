@@ -2,6 +2,9 @@ package routes
 
 import (
 	"boilerplate/app/controllers"
+	"boilerplate/app/middleware"
+	"boilerplate/config"
+	"boilerplate/pkg/ratelimiter"
 	"strings"
 
 	"github.com/gofiber/fiber/v3"
@@ -29,25 +32,49 @@ func isReservedCode(code string) bool {
 	return false
 }
 
-// SetupWeb registers web routes
-func SetupWeb(app *fiber.App) {
+// SetupWeb registers web routes, throttling /shorten per client IP by limiter
+func SetupWeb(app *fiber.App, limiter *ratelimiter.RateLimiter) {
 	// Index page (homepage)
 	app.Get("/", controllers.IndexPage)
 
 	// Public shorten endpoint (web UI)
-	app.Post("/shorten", controllers.ShortenURL)
+	app.Post("/shorten", middleware.RateLimitByIP(limiter, "shorten", ratelimiter.Limit{
+		Requests: config.RateLimit.ShortenRequests,
+		Period:   config.RateLimit.ShortenPeriod,
+	}), controllers.ShortenURL)
 
 	// Short link redirect dengan pengecekan reserved paths
-	app.Get("/:code", func(c fiber.Ctx) error {
-		code := c.Params("code")
+	shortLink := func(handler fiber.Handler) fiber.Handler {
+		return func(c fiber.Ctx) error {
+			code := c.Params("code")
 
-		// Skip jika code adalah reserved path
-		if isReservedCode(code) {
-			// Return 404 atau pass to next handler
-			return c.Status(404).SendString("Not Found")
+			// Skip jika code adalah reserved path
+			if isReservedCode(code) {
+				// Return 404 atau pass to next handler
+				return c.Status(404).SendString("Not Found")
+			}
+
+			return handler(c)
+		}
+	}
+	// Preview page, /abc+ shows where /abc goes. Registered first, the
+	// catch-all would take it as code "abc+"
+	preview := func(handler fiber.Handler) fiber.Handler {
+		return func(c fiber.Ctx) error {
+			// /abc/c++ also matches, as code "abc/c+"; it is a go-link path
+			if strings.Contains(c.Params("code"), "/") {
+				return c.Next()
+			}
+			return shortLink(handler)(c)
 		}
+	}
+	app.Get("/:code\\+", preview(controllers.PreviewLink))
+	app.Get("/:code", shortLink(controllers.Redirect))
+	// Go-link style: /:code/docs/api appends docs/api to the destination
+	app.Get("/:code/*", shortLink(controllers.Redirect))
 
-		// Handle short link redirect
-		return controllers.Redirect(c)
-	})
+	// Password form of protected links
+	app.Post("/:code\\+", preview(controllers.UnlockLink))
+	app.Post("/:code", shortLink(controllers.UnlockLink))
+	app.Post("/:code/*", shortLink(controllers.UnlockLink))
 }
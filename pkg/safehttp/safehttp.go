@@ -0,0 +1,104 @@
+package safehttp
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxRedirects caps the redirects a client follows
+const maxRedirects = 5
+
+// ErrBlockedAddress is returned when a URL resolves to an address that isn't
+// on the public internet
+var ErrBlockedAddress = errors.New("destination address is not public")
+
+// NewClient returns an HTTP client that only connects to public addresses,
+// for requests to URLs users control (link destinations, webhooks). It
+// ignores proxy settings from the environment, which would dial for it.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := Dialer(timeout)
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.New("redirect to unsupported scheme")
+			}
+			return nil
+		},
+	}
+}
+
+// Dialer returns a dialer that only connects to public addresses, for other
+// protocols than HTTP to hosts users control (NATS and RabbitMQ sinks)
+func Dialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: PublicOnly,
+	}
+}
+
+// PublicOnly is a net.Dialer Control function refusing connections to
+// loopback, private, link-local and other non-public addresses. It runs after
+// DNS resolution for every dial, so redirects and rebinding hosts can't reach
+// internal services either.
+func PublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+// IsPublicIP reports whether ip is a unicast address on the public internet
+func IsPublicIP(ip net.IP) bool {
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	// "This network" (0.0.0.0/8) and carrier-grade NAT (100.64.0.0/10)
+	if ip4 := ip.To4(); ip4 != nil && (ip4[0] == 0 || ip4[0] == 100 && ip4[1]&0xc0 == 64) {
+		return false
+	}
+	return true
+}
+
+// CheckURL rejects URLs a client from NewClient can't or mustn't call: other
+// schemes than http and https, and hosts that are non-public IP addresses or
+// localhost. Host names are checked again when they are resolved.
+func CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an absolute http or https URL")
+	}
+	return CheckHost(u.Hostname())
+}
+
+// CheckHost rejects localhost and IP addresses that aren't public. Host names
+// are checked again by Dialer when they are resolved.
+func CheckHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrBlockedAddress
+	}
+	if ip := net.ParseIP(host); ip != nil && !IsPublicIP(ip) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
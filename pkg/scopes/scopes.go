@@ -0,0 +1,76 @@
+package scopes
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// API token scopes, checked on the public API routes
+const (
+	LinksCreate = "links:create"
+	LinksRead   = "links:read"
+	LinksWrite  = "links:write"
+	StatsRead   = "stats:read"
+)
+
+// All lists every scope. Tokens created without explicit scopes get all of
+// them, matching the behavior of tokens issued before scopes existed.
+var All = List{LinksCreate, LinksRead, LinksWrite, StatsRead}
+
+// IsValid reports whether scope is a known scope
+func IsValid(scope string) bool {
+	return All.Has(scope)
+}
+
+// List is a set of scopes stored as a comma separated column
+type List []string
+
+// Has reports whether the list grants the scope
+func (l List) Has(scope string) bool {
+	for _, s := range l {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns an error naming the first unknown scope
+func (l List) Validate() error {
+	for _, s := range l {
+		if !IsValid(s) {
+			return fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	return nil
+}
+
+// Value stores the list as "links:read,links:write"
+func (l List) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+// Scan reads a comma separated list
+func (l *List) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+		*l = List{}
+		return nil
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into scopes.List", value)
+	}
+
+	*l = List{}
+	for _, s := range strings.Split(raw, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func setKey(t *testing.T, b byte) {
+	t.Helper()
+	if err := SetMasterKey(bytes.Repeat([]byte{b}, 32)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	setKey(t, 1)
+
+	tests := []struct {
+		name      string
+		plaintext string
+	}{
+		{name: "empty", plaintext: ""},
+		{name: "password", plaintext: "s3cret-p@ss"},
+		{name: "with separator", plaintext: "user:pass:enc:v1:x"},
+		{name: "unicode", plaintext: "pässwörd 🔑"},
+		{name: "long", plaintext: strings.Repeat("x", 4096)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := Encrypt(tt.plaintext)
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			if !IsEncrypted(encrypted) {
+				t.Errorf("Encrypt() = %q, missing %q prefix", encrypted, envelopePrefix)
+			}
+			if tt.plaintext != "" && strings.Contains(encrypted, tt.plaintext) {
+				t.Errorf("Encrypt() = %q contains the plaintext", encrypted)
+			}
+
+			decrypted, err := Decrypt(encrypted)
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if decrypted != tt.plaintext {
+				t.Errorf("Decrypt() = %q, want %q", decrypted, tt.plaintext)
+			}
+		})
+	}
+}
+
+func TestEncryptIsRandomized(t *testing.T) {
+	setKey(t, 1)
+
+	a, _ := Encrypt("same")
+	b, _ := Encrypt("same")
+	if a == b {
+		t.Error("Encrypt() returned the same value twice")
+	}
+}
+
+func TestDecryptRejectsTampering(t *testing.T) {
+	setKey(t, 1)
+	encrypted, err := Encrypt("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, ciphertext, _ := strings.Cut(strings.TrimPrefix(encrypted, envelopePrefix), ":")
+
+	// flip changes one bit of byte i of a base64 part, counting from the end
+	// when i is negative
+	flip := func(part string, i int) string {
+		raw, _ := base64.StdEncoding.DecodeString(part)
+		if i < 0 {
+			i += len(raw)
+		}
+		raw[i] ^= 1
+		return base64.StdEncoding.EncodeToString(raw)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "nonce bit flipped", value: envelopePrefix + wrapped + ":" + flip(ciphertext, 0)},
+		{name: "ciphertext bit flipped", value: envelopePrefix + wrapped + ":" + flip(ciphertext, 12)},
+		{name: "tag bit flipped", value: envelopePrefix + wrapped + ":" + flip(ciphertext, -1)},
+		{name: "data key bit flipped", value: envelopePrefix + flip(wrapped, 20) + ":" + ciphertext},
+		{name: "ciphertext truncated", value: envelopePrefix + wrapped + ":" + base64.StdEncoding.EncodeToString([]byte("short"))},
+		{name: "missing ciphertext", value: envelopePrefix + wrapped},
+		{name: "invalid base64", value: envelopePrefix + wrapped + ":!!!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := Decrypt(tt.value); err == nil {
+				t.Errorf("Decrypt() = %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestDecryptWithOtherKey(t *testing.T) {
+	setKey(t, 1)
+	encrypted, err := Encrypt("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setKey(t, 2)
+	defer setKey(t, 1)
+	if got, err := Decrypt(encrypted); err == nil {
+		t.Errorf("Decrypt() with another key = %q, want an error", got)
+	}
+}
+
+func TestDecryptLegacyPlaintext(t *testing.T) {
+	setKey(t, 1)
+
+	got, err := Decrypt("plain-value")
+	if err != nil || got != "plain-value" {
+		t.Errorf("Decrypt() = %q, %v, want the value unchanged", got, err)
+	}
+}
+
+func TestSetMasterKeyLength(t *testing.T) {
+	for _, size := range []int{0, 16, 31, 33, 64} {
+		if err := SetMasterKey(make([]byte, size)); err == nil {
+			t.Errorf("SetMasterKey() with %d bytes succeeded, want an error", size)
+		}
+	}
+}
+
+func TestEncryptedString(t *testing.T) {
+	setKey(t, 1)
+
+	value, err := EncryptedString("s3cret").Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, ok := value.(string)
+	if !ok || !IsEncrypted(stored) {
+		t.Fatalf("Value() = %v, want an encrypted string", value)
+	}
+
+	var scanned EncryptedString
+	if err := scanned.Scan([]byte(stored)); err != nil || scanned != "s3cret" {
+		t.Errorf("Scan() = %q, %v, want s3cret", scanned, err)
+	}
+
+	data, _ := json.Marshal(scanned)
+	if string(data) != `"`+Redacted+`"` {
+		t.Errorf("json.Marshal() = %s, want the redacted value", data)
+	}
+}
@@ -0,0 +1,88 @@
+package tags
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxPerLink caps the number of tags on a link
+const MaxPerLink = 20
+
+// pattern is what a tag may look like: letters, digits and _ : . -, starting
+// with a letter or digit. Tags are stored lowercase.
+var pattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_:.-]{0,49}$`)
+
+// IsValid reports whether tag is a well-formed tag
+func IsValid(tag string) bool {
+	return pattern.MatchString(tag)
+}
+
+// List is a set of tags stored as a Postgres text[] column
+type List []string
+
+// Normalize lowercases the tags and drops duplicates, keeping their order.
+// A nil list stays nil.
+func (l List) Normalize() List {
+	if l == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(l))
+	normalized := List{}
+	for _, tag := range l {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// Parse splits a comma separated list, e.g. a CSV cell or query parameter
+func Parse(raw string) List {
+	var l List
+	for _, tag := range strings.Split(raw, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			l = append(l, tag)
+		}
+	}
+	return l.Normalize()
+}
+
+// String joins the tags with commas, the inverse of Parse
+func (l List) String() string {
+	return strings.Join(l, ",")
+}
+
+// Value stores the list as an array literal, e.g. {launch,q3}. Valid tags
+// need no quoting.
+func (l List) Value() (driver.Value, error) {
+	return "{" + strings.Join(l, ",") + "}", nil
+}
+
+// Scan reads an array literal
+func (l *List) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+		*l = List{}
+		return nil
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into tags.List", value)
+	}
+
+	*l = List{}
+	raw = strings.TrimSuffix(strings.TrimPrefix(raw, "{"), "}")
+	for _, tag := range strings.Split(raw, ",") {
+		if tag = strings.Trim(tag, `" `); tag != "" {
+			*l = append(*l, tag)
+		}
+	}
+	return nil
+}
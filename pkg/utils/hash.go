@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// HashIP returns a keyed hash (HMAC-SHA256) of an IP address so clicks can
+// be grouped per visitor without storing the raw address. Without the key the
+// small IPv4 space could simply be enumerated.
+func HashIP(key []byte, ip string) string {
+	return Sign(key, "ip-hash:"+ip)
+}
+
+// HashToken returns a SHA-256 hex digest of a secret token, used to store
+// session IDs and other bearer secrets without keeping the raw value
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return fmt.Sprintf("%x", hash)
+}
+
+// TokenPrefixLength is the number of leading characters of an API token
+// stored in plaintext to find the token without scanning every hash
+const TokenPrefixLength = 8
+
+// GenerateAPIToken returns a new API token: a random base62 lookup prefix
+// followed by a high-entropy secret
+func GenerateAPIToken() (string, error) {
+	secret, err := GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	return GenerateShortCodeWithLength(TokenPrefixLength) + "_" + secret, nil
+}
+
+// TokenPrefix returns the lookup prefix of an API token
+func TokenPrefix(token string) string {
+	if len(token) < TokenPrefixLength {
+		return token
+	}
+	return token[:TokenPrefixLength]
+}
+
+// GenerateSecureToken returns a URL-safe random token with n bytes of entropy
+func GenerateSecureToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Sign returns a hex HMAC-SHA256 of message, used to make values handed to
+// clients, like cookies, tamper-proof
+func Sign(key []byte, message string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports in constant time whether signature is Sign(key, message)
+func VerifySignature(key []byte, message, signature string) bool {
+	return hmac.Equal([]byte(Sign(key, message)), []byte(signature))
+}
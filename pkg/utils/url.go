@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// placeholder matches the {path} and {1} to {9} placeholders of a destination
+var placeholder = regexp.MustCompile(`\{(path|[1-9])\}`)
+
+// NormalizeURL returns a canonical form of a link destination for comparing
+// URLs: lowercase scheme and host, no trailing dot or default port, and "/"
+// for an empty path. Query and fragment are kept as they are.
+func NormalizeURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := u.Hostname(), u.Port()
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+
+	if u.Path == "" && u.RawPath == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// HashURL returns a SHA-256 hex digest of the normalized URL, used to find
+// links with the same destination through an index
+func HashURL(rawURL string) string {
+	return HashToken(NormalizeURL(rawURL))
+}
+
+// ExpandDestination returns where a request for /<code>/<suffix>?<query>
+// goes. {path} in dest is replaced with the suffix and {1} to {9} with its
+// segments, empty when missing; a destination without placeholders gets the
+// suffix appended to its path. query is added to the destination's query,
+// except for parameters the destination already sets. The scheme and host
+// of dest are never changed, so the result stays on the screened domain.
+func ExpandDestination(dest, suffix string, query url.Values) string {
+	var segments []string
+	for _, segment := range strings.Split(suffix, "/") {
+		if segment == "" {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segment = unescaped
+		}
+		segments = append(segments, segment)
+	}
+
+	head, rest := splitAuthority(dest)
+	path, tail := rest, ""
+	if i := strings.IndexAny(rest, "?#"); i >= 0 {
+		path, tail = rest[:i], rest[i:]
+	}
+
+	if placeholder.MatchString(rest) {
+		path = expandPlaceholders(path, segments, url.PathEscape)
+		tail = expandPlaceholders(tail, segments, url.QueryEscape)
+	} else if len(segments) > 0 {
+		escaped := make([]string, len(segments))
+		for i, segment := range segments {
+			escaped[i] = url.PathEscape(segment)
+		}
+		path = strings.TrimSuffix(path, "/") + "/" + strings.Join(escaped, "/")
+		if strings.HasSuffix(suffix, "/") {
+			path += "/"
+		}
+	}
+
+	if len(query) > 0 {
+		tail = mergeQuery(tail, query)
+	}
+	return head + path + tail
+}
+
+// splitAuthority splits a URL after its scheme and host
+func splitAuthority(rawURL string) (string, string) {
+	start := strings.Index(rawURL, "://")
+	if start < 0 {
+		return rawURL, ""
+	}
+	start += len("://")
+	end := strings.IndexAny(rawURL[start:], "/?#")
+	if end < 0 {
+		return rawURL, ""
+	}
+	return rawURL[:start+end], rawURL[start+end:]
+}
+
+// expandPlaceholders replaces the placeholders in s, escaping the values
+func expandPlaceholders(s string, segments []string, escape func(string) string) string {
+	return placeholder.ReplaceAllStringFunc(s, func(match string) string {
+		name := match[1 : len(match)-1]
+		if name == "path" {
+			escaped := make([]string, len(segments))
+			for i, segment := range segments {
+				escaped[i] = escape(segment)
+			}
+			return strings.Join(escaped, "/")
+		}
+		n, _ := strconv.Atoi(name)
+		if n > len(segments) {
+			return ""
+		}
+		return escape(segments[n-1])
+	})
+}
+
+// mergeQuery adds the parameters of query that tail ("?query#fragment")
+// doesn't have yet, keeping tail's own encoding
+func mergeQuery(tail string, query url.Values) string {
+	rawQuery, fragment := tail, ""
+	if i := strings.Index(tail, "#"); i >= 0 {
+		rawQuery, fragment = tail[:i], tail[i:]
+	}
+	rawQuery = strings.TrimPrefix(rawQuery, "?")
+
+	existing, _ := url.ParseQuery(rawQuery)
+	added := url.Values{}
+	for key, values := range query {
+		if _, ok := existing[key]; !ok {
+			added[key] = values
+		}
+	}
+	if len(added) == 0 {
+		return tail
+	}
+
+	if rawQuery != "" {
+		rawQuery += "&"
+	}
+	return "?" + rawQuery + added.Encode() + fragment
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestExpandDestination(t *testing.T) {
+	tests := []struct {
+		name   string
+		dest   string
+		suffix string
+		query  url.Values
+		want   string
+	}{
+		{
+			name: "no suffix or query",
+			dest: "https://example.com/docs",
+			want: "https://example.com/docs",
+		},
+		{
+			name:   "suffix is appended to the path",
+			dest:   "https://example.com/docs",
+			suffix: "guide/intro",
+			want:   "https://example.com/docs/guide/intro",
+		},
+		{
+			name:   "suffix after a trailing slash",
+			dest:   "https://example.com/docs/",
+			suffix: "intro",
+			want:   "https://example.com/docs/intro",
+		},
+		{
+			name:   "suffix on a bare host",
+			dest:   "https://example.com",
+			suffix: "intro",
+			want:   "https://example.com/intro",
+		},
+		{
+			name:   "trailing slash of the suffix is kept",
+			dest:   "https://example.com/docs",
+			suffix: "guide/",
+			want:   "https://example.com/docs/guide/",
+		},
+		{
+			name:   "suffix goes before the destination's query",
+			dest:   "https://example.com/docs?lang=en#top",
+			suffix: "intro",
+			want:   "https://example.com/docs/intro?lang=en#top",
+		},
+		{
+			name:   "suffix segments are escaped",
+			dest:   "https://example.com/docs",
+			suffix: "a%20b/c?d",
+			want:   "https://example.com/docs/a%20b/c%3Fd",
+		},
+		{
+			name:   "dot segments can't leave the host",
+			dest:   "https://example.com/docs",
+			suffix: "..%2F..%2Fevil.example",
+			want:   "https://example.com/docs/..%2F..%2Fevil.example",
+		},
+		{
+			name:   "path placeholder",
+			dest:   "https://example.com/search?q={path}",
+			suffix: "go/generics",
+			want:   "https://example.com/search?q=go/generics",
+		},
+		{
+			name:   "numbered placeholders",
+			dest:   "https://github.com/{1}/{2}/issues",
+			suffix: "golang/go",
+			want:   "https://github.com/golang/go/issues",
+		},
+		{
+			name:   "missing segments are empty",
+			dest:   "https://example.com/{1}/{2}",
+			suffix: "only",
+			want:   "https://example.com/only/",
+		},
+		{
+			name:   "placeholder values are escaped for the query",
+			dest:   "https://example.com/search?q={1}",
+			suffix: "a%26b=c",
+			want:   "https://example.com/search?q=a%26b%3Dc",
+		},
+		{
+			name: "unused placeholders are removed",
+			dest: "https://example.com/{path}",
+			want: "https://example.com/",
+		},
+		{
+			name:  "query is added",
+			dest:  "https://example.com/docs",
+			query: url.Values{"utm_source": {"mail"}},
+			want:  "https://example.com/docs?utm_source=mail",
+		},
+		{
+			name:  "query is merged into the destination's query",
+			dest:  "https://example.com/docs?lang=en",
+			query: url.Values{"page": {"2"}},
+			want:  "https://example.com/docs?lang=en&page=2",
+		},
+		{
+			name:  "destination parameters win",
+			dest:  "https://example.com/docs?lang=en",
+			query: url.Values{"lang": {"de"}},
+			want:  "https://example.com/docs?lang=en",
+		},
+		{
+			name:  "query goes before the fragment",
+			dest:  "https://example.com/docs#intro",
+			query: url.Values{"a": {"1"}},
+			want:  "https://example.com/docs?a=1#intro",
+		},
+		{
+			name:  "destination query encoding is kept",
+			dest:  "https://example.com/docs?q=a+b%2Fc",
+			query: url.Values{"x": {"1 2"}},
+			want:  "https://example.com/docs?q=a+b%2Fc&x=1+2",
+		},
+		{
+			name:   "suffix and query together",
+			dest:   "https://example.com/docs?lang=en",
+			suffix: "intro",
+			query:  url.Values{"lang": {"de"}, "ref": {"x"}},
+			want:   "https://example.com/docs/intro?lang=en&ref=x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExpandDestination(tt.dest, tt.suffix, tt.query); got != tt.want {
+				t.Errorf("ExpandDestination(%q, %q, %v) = %q, want %q", tt.dest, tt.suffix, tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package validation
+
+import (
+	"boilerplate/pkg/tags"
+	"boilerplate/pkg/utils"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Validator checks request structs against their `validate` tags. It is
+// plugged into Fiber as StructValidator, so c.Bind() validates after decoding.
+type Validator struct {
+	validate *validator.Validate
+}
+
+// FieldError describes one invalid request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// New creates a validator that reports fields by their JSON name and knows
+// the custom "shortcode" and "tag" rules
+func New() *Validator {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(jsonName)
+
+	// shortcode: a custom short code as accepted by utils.ValidateCode
+	_ = v.RegisterValidation("shortcode", func(fl validator.FieldLevel) bool {
+		return utils.ValidateCode(fl.Field().String())
+	})
+	// tag: a link tag as accepted by tags.IsValid, used with dive on tag lists
+	_ = v.RegisterValidation("tag", func(fl validator.FieldLevel) bool {
+		return tags.IsValid(fl.Field().String())
+	})
+
+	return &Validator{validate: v}
+}
+
+// Validate implements fiber.StructValidator
+func (v *Validator) Validate(out any) error {
+	return v.validate.Struct(out)
+}
+
+// Errors returns the field errors of a validation error, or false if err
+// is not one (e.g. malformed JSON)
+func Errors(err error) ([]FieldError, bool) {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return nil, false
+	}
+
+	fields := make([]FieldError, len(validationErrs))
+	for i, fe := range validationErrs {
+		fields[i] = FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: message(fe),
+		}
+	}
+	return fields, true
+}
+
+// message turns a failed rule into a readable sentence
+func message(fe validator.FieldError) string {
+	field := fe.Field()
+	isString := fe.Kind() == reflect.String
+	isList := fe.Kind() == reflect.Slice
+
+	switch fe.Tag() {
+	case "required":
+		return field + " is required"
+	case "url":
+		return field + " must be a valid URL"
+	case "shortcode":
+		return field + " must be 4-20 alphanumeric characters"
+	case "tag":
+		return field + " must be 1-50 letters, digits, _ : . or -, starting with a letter or digit"
+	case "oneof":
+		return field + " must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "min":
+		if isString {
+			return fmt.Sprintf("%s must be at least %s characters", field, fe.Param())
+		}
+		return fmt.Sprintf("%s must be at least %s", field, fe.Param())
+	case "max":
+		if isString {
+			return fmt.Sprintf("%s must be at most %s characters", field, fe.Param())
+		}
+		if isList {
+			return fmt.Sprintf("%s must have at most %s items", field, fe.Param())
+		}
+		return fmt.Sprintf("%s must be at most %s", field, fe.Param())
+	}
+	return field + " is invalid"
+}
+
+// jsonName reports struct fields by their JSON name
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
@@ -1,7 +1,6 @@
 package database
 
 import (
-	"boilerplate/app/models"
 	"boilerplate/config"
 	"fmt"
 	"log"
@@ -28,22 +27,24 @@ func Connect() {
 
 	fmt.Println("Connected to PostgreSQL database")
 
-	// Auto migrate models
-	err = DB.AutoMigrate(
-		&models.AdminUser{},
-		&models.APIToken{},
-		&models.Link{},
-	)
+	// Prefork children and other instances connect at the same time, the
+	// lock makes them migrate and seed one after another
+	err = withMigrationLock(DB, func(conn *gorm.DB) error {
+		if err := migrate(conn); err != nil {
+			return err
+		}
 
-	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
-	}
+		fmt.Println("Database migration completed")
 
-	fmt.Println("Database migration completed")
+		// Seed default data
+		if err := Seed(conn); err != nil {
+			log.Printf("Warning: Failed to seed database: %v", err)
+		}
+		return nil
+	})
 
-	// Seed default data
-	if err := Seed(DB); err != nil {
-		log.Printf("Warning: Failed to seed database: %v", err)
+	if err != nil {
+		log.Fatal("Failed to migrate database:", err)
 	}
 }
 
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"boilerplate/app/models"
+	"boilerplate/pkg/secrets"
+	"boilerplate/pkg/utils"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// migrationLockID is the key of the Postgres advisory lock held while
+// migrating
+const migrationLockID = 7362201601
+
+// withMigrationLock runs fn on a single connection that holds a session
+// advisory lock, so concurrent starts wait for each other instead of running
+// the data migrations twice. Postgres releases the lock if the process dies.
+func withMigrationLock(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockID).Error; err != nil {
+			return fmt.Errorf("failed to take migration lock: %w", err)
+		}
+		defer func() {
+			if err := conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockID).Error; err != nil {
+				log.Printf("Failed to release migration lock: %v", err)
+			}
+		}()
+
+		return fn(conn)
+	})
+}
+
+// migrate brings the schema and existing data up to date
+func migrate(db *gorm.DB) error {
+	// Migrate data that AutoMigrate can't handle on its own
+	if err := migrateAPITokenHashes(db); err != nil {
+		return err
+	}
+
+	if err := migrateLinkCodeIndex(db); err != nil {
+		return err
+	}
+
+	// Auto migrate models
+	err := db.AutoMigrate(
+		&models.AdminUser{},
+		&models.AdminSession{},
+		&models.Domain{},
+		&models.APIToken{},
+		&models.Link{},
+		&models.Click{},
+		&models.OutboxEvent{},
+		&models.DomainRule{},
+		&models.IdempotencyKey{},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := migrateEncryptedSecrets(db); err != nil {
+		return err
+	}
+
+	if err := migrateLinkURLHashes(db); err != nil {
+		return err
+	}
+
+	if err := migrateLinkSearchIndexes(db); err != nil {
+		return err
+	}
+
+	return migrateLinkDomainCodes(db)
+}
+
+// migrateAPITokenHashes converts plaintext API tokens to hashed tokens.
+// It must run before AutoMigrate, which would otherwise try to add a unique
+// index on an empty token_hash column for every existing row.
+func migrateAPITokenHashes(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.APIToken{}) ||
+		!migrator.HasColumn(&models.APIToken{}, "token") ||
+		migrator.HasColumn(&models.APIToken{}, "token_hash") {
+		return nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			"ALTER TABLE api_tokens ADD COLUMN token_hash varchar(64), ADD COLUMN token_prefix varchar(16)",
+			"UPDATE api_tokens SET token_hash = encode(sha256(token::bytea), 'hex'), token_prefix = left(token, 8)",
+			"ALTER TABLE api_tokens DROP COLUMN token",
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to hash existing API tokens: %w", err)
+	}
+
+	log.Println("Existing API tokens migrated to hashed storage")
+	return nil
+}
+
+// migrateEncryptedSecrets encrypts API token secrets that were stored before
+// encryption at rest was introduced. Already encrypted values are left alone.
+func migrateEncryptedSecrets(db *gorm.DB) error {
+	var rows []struct {
+		ID               uint
+		SinkSecret       string
+		RabbitMQPassword string
+	}
+	err := db.Table("api_tokens").
+		Select("id, COALESCE(sink_secret, '') AS sink_secret, COALESCE(rabbit_mq_password, '') AS rabbit_mq_password").
+		Where("(sink_secret <> '' AND sink_secret NOT LIKE ?) OR (rabbit_mq_password <> '' AND rabbit_mq_password NOT LIKE ?)", "enc:v1:%", "enc:v1:%").
+		Find(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		updates := map[string]interface{}{}
+		for column, value := range map[string]string{
+			"sink_secret":        row.SinkSecret,
+			"rabbit_mq_password": row.RabbitMQPassword,
+		} {
+			if value == "" || secrets.IsEncrypted(value) {
+				continue
+			}
+			encrypted, err := secrets.Encrypt(value)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt secrets of API token %d: %w", row.ID, err)
+			}
+			updates[column] = encrypted
+		}
+		if err := db.Table("api_tokens").Where("id = ?", row.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(rows) > 0 {
+		log.Printf("Encrypted secrets of %d existing API tokens", len(rows))
+	}
+	return nil
+}
+
+// migrateLinkURLHashes fills in the destination hash of links created before
+// links could be de-duplicated, in batches to keep transactions small
+func migrateLinkURLHashes(db *gorm.DB) error {
+	const batchSize = 1000
+	total := 0
+	for {
+		var rows []struct {
+			ID          uint
+			OriginalURL string
+		}
+		err := db.Table("links").
+			Select("id, original_url").
+			Where("url_hash IS NULL OR url_hash = ''").
+			Order("id").
+			Limit(batchSize).
+			Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for _, row := range rows {
+				if err := tx.Table("links").Where("id = ?", row.ID).Update("url_hash", utils.HashURL(row.OriginalURL)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to hash link destinations: %w", err)
+		}
+		total += len(rows)
+	}
+
+	if total > 0 {
+		log.Printf("Hashed destinations of %d existing links", total)
+	}
+	return nil
+}
+
+// migrateLinkSearchIndexes creates the indexes behind the admin link search:
+// trigram indexes for substring matches on code, URL and title, and a
+// full-text index over title and note. pg_trgm needs a privileged role on
+// some hosts; without it search still works, just with sequential scans.
+func migrateLinkSearchIndexes(db *gorm.DB) error {
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		log.Printf("Warning: pg_trgm is not available, link search won't be indexed: %v", err)
+	} else {
+		for _, column := range []string{"code", "original_url", "title"} {
+			sql := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_links_%s_trgm ON links USING gin (%s gin_trgm_ops)", column, column)
+			if err := db.Exec(sql).Error; err != nil {
+				return fmt.Errorf("failed to create link search index: %w", err)
+			}
+		}
+	}
+
+	// The expression must match LinkQuery's search to be used
+	err := db.Exec("CREATE INDEX IF NOT EXISTS idx_links_fts ON links USING gin (to_tsvector('simple', title || ' ' || note))").Error
+	if err != nil {
+		return fmt.Errorf("failed to create link search index: %w", err)
+	}
+	return nil
+}
+
+// migrateLinkCodeIndex drops the global unique index on links.code from
+// before codes were namespaced per domain. It must run before AutoMigrate,
+// which would otherwise keep it since the plain index has the same name.
+func migrateLinkCodeIndex(db *gorm.DB) error {
+	var unique bool
+	err := db.Raw("SELECT EXISTS (SELECT 1 FROM pg_indexes WHERE tablename = 'links' AND indexname = 'idx_links_code' AND indexdef LIKE 'CREATE UNIQUE%')").
+		Scan(&unique).Error
+	if err != nil || !unique {
+		return err
+	}
+	if err := db.Exec("DROP INDEX idx_links_code").Error; err != nil {
+		return fmt.Errorf("failed to drop unique code index: %w", err)
+	}
+	log.Println("Dropped the global unique index on link codes")
+	return nil
+}
+
+// migrateLinkDomainCodes makes codes unique per domain. Links of the default
+// domain have no domain_id, and NULLs never conflict in a unique index, so
+// the index is on COALESCE(domain_id, 0). Soft-deleted links keep their code.
+func migrateLinkDomainCodes(db *gorm.DB) error {
+	err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_links_domain_code ON links ((COALESCE(domain_id, 0)), code)").Error
+	if err != nil {
+		return fmt.Errorf("failed to create domain code index: %w", err)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"boilerplate/app/models"
 	"boilerplate/app/queries"
+	"boilerplate/pkg/rbac"
 	"fmt"
 	"log"
 
@@ -14,8 +15,12 @@ func Seed(db *gorm.DB) error {
 	adminQuery := &queries.AdminUserQuery{DB: db}
 
 	// Check if admin user already exists
-	_, err := adminQuery.GetByUsername("admin")
+	existingAdmin, err := adminQuery.GetByUsername("admin")
 	if err == nil {
+		// Installations from before roles existed have no owner yet
+		if err := ensureOwner(adminQuery, existingAdmin); err != nil {
+			return err
+		}
 		log.Println("Admin user already exists, skipping seed")
 		return nil
 	}
@@ -23,6 +28,7 @@ func Seed(db *gorm.DB) error {
 	// Create default admin user
 	adminUser := &models.AdminUser{
 		Username: "admin",
+		Role:     rbac.RoleOwner,
 	}
 
 	// Default password: admin123 (change this in production!)
@@ -38,3 +44,21 @@ func Seed(db *gorm.DB) error {
 
 	return nil
 }
+
+// ensureOwner promotes the default admin user to owner if no owner exists
+func ensureOwner(adminQuery *queries.AdminUserQuery, adminUser *models.AdminUser) error {
+	owners, err := adminQuery.CountByRole(rbac.RoleOwner)
+	if err != nil {
+		return fmt.Errorf("failed to count owners: %w", err)
+	}
+	if owners > 0 {
+		return nil
+	}
+
+	adminUser.Role = rbac.RoleOwner
+	if err := adminQuery.Update(adminUser.ID, adminUser, ""); err != nil {
+		return fmt.Errorf("failed to promote admin user to owner: %w", err)
+	}
+	log.Println("Default admin user promoted to owner")
+	return nil
+}
@@ -0,0 +1,206 @@
+package linkcache
+
+import (
+	"boilerplate/app/models"
+	"boilerplate/config"
+	"boilerplate/pkg/cache"
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	// notifyChannel is the Postgres channel carrying invalidated codes
+	notifyChannel = "link_cache_invalidate"
+
+	// purgeAll is the payload that invalidates every cached code
+	purgeAll = "*"
+
+	// reconnectDelay is how long the listener waits before reconnecting
+	reconnectDelay = 5 * time.Second
+)
+
+var (
+	links       *cache.LRU[string, *models.Link]
+	domains     *cache.LRU[string, *models.Domain]
+	ttl         time.Duration
+	negativeTTL time.Duration
+	db          *gorm.DB
+
+	// generation is bumped on every invalidation, so a lookup that raced
+	// with an invalidation doesn't cache what it loaded
+	generation atomic.Uint64
+)
+
+// Start enables the redirect cache and subscribes to invalidations from other
+// processes. With a size of 0 the cache is disabled and Get always loads.
+func Start(database *gorm.DB, cfg *config.CacheConfig) {
+	if cfg.Size <= 0 {
+		log.Println("Redirect cache disabled")
+		return
+	}
+
+	links = cache.NewLRU[string, *models.Link](cfg.Size)
+	domains = cache.NewLRU[string, *models.Domain](cfg.Size)
+	ttl = cfg.TTL
+	negativeTTL = cfg.NegativeTTL
+	db = database
+
+	go listen(config.DB.GetDSN())
+}
+
+// key is the cache key and invalidation payload of a code on a domain
+func key(domainID *uint, code string) string {
+	id := uint(0)
+	if domainID != nil {
+		id = *domainID
+	}
+	return strconv.FormatUint(uint64(id), 10) + ":" + code
+}
+
+// Get returns the link for code on a domain from the cache, calling load on
+// a miss. Unknown codes are cached too and reported as gorm.ErrRecordNotFound.
+// The returned link is a copy and may be modified by the caller.
+func Get(domainID *uint, code string, load func(domainID *uint, code string) (*models.Link, error)) (*models.Link, error) {
+	if links == nil {
+		return load(domainID, code)
+	}
+
+	k := key(domainID, code)
+	if link, ok := links.Get(k); ok {
+		if link == nil {
+			return nil, gorm.ErrRecordNotFound
+		}
+		clone := *link
+		return &clone, nil
+	}
+
+	gen := generation.Load()
+	link, err := load(domainID, code)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) && generation.Load() == gen {
+			links.Set(k, nil, negativeTTL)
+		}
+		return nil, err
+	}
+
+	if generation.Load() == gen {
+		clone := *link
+		links.Set(k, &clone, ttl)
+	}
+	return link, nil
+}
+
+// Domain returns the domain registered for host, or nil for the default
+// domain, calling load on a miss. Unknown hosts are cached too.
+func Domain(host string, load func(host string) (*models.Domain, error)) (*models.Domain, error) {
+	host = strings.ToLower(host)
+	if domains == nil {
+		return loadDomain(host, load)
+	}
+
+	if domain, ok := domains.Get(host); ok {
+		return domain, nil
+	}
+
+	gen := generation.Load()
+	domain, err := loadDomain(host, load)
+	if err != nil {
+		return nil, err
+	}
+	if generation.Load() == gen {
+		domains.Set(host, domain, ttl)
+	}
+	return domain, nil
+}
+
+// loadDomain calls load, turning gorm.ErrRecordNotFound into a nil domain
+func loadDomain(host string, load func(host string) (*models.Domain, error)) (*models.Domain, error) {
+	domain, err := load(host)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return domain, err
+}
+
+// Invalidate drops codes of a domain from this process's cache and tells
+// every other process (prefork children and other instances) to do the same
+func Invalidate(domainID *uint, codes ...string) {
+	if links == nil {
+		return
+	}
+	for _, code := range codes {
+		k := key(domainID, code)
+		evict(k)
+		notify(k)
+	}
+}
+
+// InvalidateAll drops every cached link and domain in all processes, e.g.
+// after an API token that is preloaded on links or a domain changed
+func InvalidateAll() {
+	if links == nil {
+		return
+	}
+	evict(purgeAll)
+	notify(purgeAll)
+}
+
+// evict applies an invalidation payload to the local cache
+func evict(payload string) {
+	generation.Add(1)
+	if payload == purgeAll {
+		links.Purge()
+		domains.Purge()
+		return
+	}
+	links.Delete(payload)
+}
+
+func notify(payload string) {
+	if err := db.Exec("SELECT pg_notify(?, ?)", notifyChannel, payload).Error; err != nil {
+		log.Printf("Failed to publish cache invalidation for %q: %v", payload, err)
+	}
+}
+
+// listen applies invalidations from other processes, reconnecting on failure
+func listen(dsn string) {
+	for {
+		if err := listenOnce(dsn); err != nil {
+			log.Printf("Redirect cache listener: %v", err)
+		}
+		time.Sleep(reconnectDelay)
+	}
+}
+
+func listenOnce(dsn string) error {
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		return err
+	}
+
+	// Invalidations sent while we weren't listening are lost, start clean
+	evict(purgeAll)
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		evict(notification.Payload)
+	}
+}
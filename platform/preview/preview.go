@@ -0,0 +1,237 @@
+package preview
+
+import (
+	"boilerplate/config"
+	"boilerplate/pkg/cache"
+	"boilerplate/pkg/safehttp"
+	"cmp"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// cacheSize caps the destinations whose page details are kept
+	cacheSize = 1000
+
+	// maxBodySize is how much of a destination page is read; the title and
+	// icons are in the head
+	maxBodySize = 512 << 10
+
+	// maxTitleLength caps the title shown on the preview page, in runes
+	maxTitleLength = 200
+)
+
+// Page is what the preview shows about a destination besides its URL. Both
+// fields may be empty.
+type Page struct {
+	Title   string
+	Favicon string
+}
+
+var (
+	pages  *cache.LRU[string, *Page]
+	client *http.Client
+	ttl    time.Duration
+
+	// fetching holds the destinations being fetched in the background
+	fetching   = make(map[string]bool)
+	fetchingMu sync.Mutex
+)
+
+// Start sets up fetching of destination pages. With a timeout of 0 Fetch
+// doesn't fetch and only guesses the favicon.
+func Start(cfg *config.PreviewConfig) {
+	if cfg.FetchTimeout <= 0 {
+		return
+	}
+
+	pages = cache.NewLRU[string, *Page](cacheSize)
+	ttl = cfg.CacheTTL
+
+	// Destinations are user input, never fetch from internal addresses
+	client = safehttp.NewClient(cfg.FetchTimeout)
+}
+
+// Fetch returns the title and favicon of the page at rawURL. Results,
+// failures included, are cached, so a destination is fetched at most once
+// per CacheTTL. Pages that can't be fetched fall back to /favicon.ico.
+func Fetch(rawURL string) *Page {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return &Page{}
+	}
+
+	if client == nil {
+		return &Page{Favicon: defaultFavicon(target)}
+	}
+
+	if page, ok := pages.Get(rawURL); ok {
+		return page
+	}
+	return fetchAndCache(rawURL, target)
+}
+
+// Cached is Fetch without waiting: it returns the cached page, or the
+// fallback favicon while the page is fetched in the background, so the next
+// view shows its details.
+func Cached(rawURL string) *Page {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return &Page{}
+	}
+
+	if client == nil {
+		return &Page{Favicon: defaultFavicon(target)}
+	}
+
+	if page, ok := pages.Get(rawURL); ok {
+		return page
+	}
+
+	fetchingMu.Lock()
+	started := fetching[rawURL]
+	fetching[rawURL] = true
+	fetchingMu.Unlock()
+
+	if !started {
+		go func() {
+			fetchAndCache(rawURL, target)
+
+			fetchingMu.Lock()
+			delete(fetching, rawURL)
+			fetchingMu.Unlock()
+		}()
+	}
+	return &Page{Favicon: defaultFavicon(target)}
+}
+
+// fetchAndCache fetches the page and caches the result, failures included
+func fetchAndCache(rawURL string, target *url.URL) *Page {
+	page, err := fetch(target)
+	if err != nil {
+		page = &Page{Favicon: defaultFavicon(target)}
+	}
+	pages.Set(rawURL, page, ttl)
+	return page
+}
+
+func fetch(target *url.URL) (*Page, error) {
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "onjourney.link-preview/1.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.Contains(contentType, "html") {
+		return nil, errors.New("not an HTML page: " + contentType)
+	}
+
+	// Relative icons resolve against the page we ended up on
+	return parse(io.LimitReader(resp.Body, maxBodySize), resp.Request.URL), nil
+}
+
+// parse reads the title and icon of an HTML page, stopping at <body>
+func parse(r io.Reader, base *url.URL) *Page {
+	page := &Page{}
+	var ogTitle, icon, touchIcon string
+	inTitle := false
+
+	tokenizer := html.NewTokenizer(r)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return finish(page, ogTitle, cmp.Or(icon, touchIcon), base)
+		case html.TextToken:
+			if inTitle {
+				page.Title += string(tokenizer.Text())
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if string(name) == "title" {
+				inTitle = false
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "body":
+				return finish(page, ogTitle, cmp.Or(icon, touchIcon), base)
+			case "title":
+				inTitle = page.Title == ""
+			case "meta":
+				if attr(token, "property") == "og:title" {
+					ogTitle = attr(token, "content")
+				}
+			case "link":
+				// The first icon wins, touch icons are used only without one
+				for _, rel := range strings.Fields(strings.ToLower(attr(token, "rel"))) {
+					switch {
+					case rel == "icon" && icon == "":
+						icon = attr(token, "href")
+					case rel == "apple-touch-icon" && touchIcon == "":
+						touchIcon = attr(token, "href")
+					}
+				}
+			}
+		}
+	}
+}
+
+// finish cleans up what parse found and resolves the icon against base
+func finish(page *Page, ogTitle, icon string, base *url.URL) *Page {
+	page.Title = cleanTitle(page.Title)
+	if page.Title == "" {
+		page.Title = cleanTitle(ogTitle)
+	}
+
+	page.Favicon = defaultFavicon(base)
+	if icon != "" {
+		if ref, err := base.Parse(icon); err == nil && (ref.Scheme == "http" || ref.Scheme == "https") {
+			page.Favicon = ref.String()
+		}
+	}
+	return page
+}
+
+// cleanTitle collapses whitespace and shortens long titles
+func cleanTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	if !utf8.ValidString(title) {
+		title = strings.ToValidUTF8(title, "")
+	}
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		title = string([]rune(title)[:maxTitleLength]) + "…"
+	}
+	return title
+}
+
+// defaultFavicon is /favicon.ico on the origin of u
+func defaultFavicon(u *url.URL) string {
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/favicon.ico"}).String()
+}
+
+func attr(token html.Token, name string) string {
+	for _, a := range token.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"boilerplate/app/models"
+	"boilerplate/app/queries"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	dispatchInterval = 1 * time.Second
+	dispatchBatch    = 100
+	claimLease       = 2 * time.Minute
+	maxAttempts      = 10
+	baseBackoff      = 5 * time.Second
+	maxBackoff       = 1 * time.Hour
+	purgeInterval    = 1 * time.Hour
+	deliveredTTL     = 7 * 24 * time.Hour
+)
+
+// StartDispatcher starts the background worker that drains the outbox table.
+// Every process may run it: events are claimed with SKIP LOCKED so prefork
+// children and other instances never deliver the same event concurrently.
+func StartDispatcher(db *gorm.DB) {
+	outboxQuery := &queries.OutboxQuery{DB: db}
+	go dispatchLoop(outboxQuery)
+	go purgeLoop(outboxQuery)
+}
+
+// dispatchLoop claims and delivers due events until the process exits
+func dispatchLoop(outboxQuery *queries.OutboxQuery) {
+	ticker := time.NewTicker(dispatchInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for {
+			events, err := outboxQuery.Claim(dispatchBatch, claimLease)
+			if err != nil {
+				log.Printf("Failed to claim outbox events: %v", err)
+				break
+			}
+			for i := range events {
+				deliver(outboxQuery, &events[i])
+			}
+			// Keep draining while batches are full
+			if len(events) < dispatchBatch {
+				break
+			}
+		}
+	}
+}
+
+// deliver publishes a single event and records the outcome
+func deliver(outboxQuery *queries.OutboxQuery, event *models.OutboxEvent) {
+	err := publish(event)
+	if err == nil {
+		if err := outboxQuery.MarkDelivered(event.ID); err != nil {
+			log.Printf("Failed to mark outbox event %d delivered: %v", event.ID, err)
+		}
+		return
+	}
+
+	attempts := event.Attempts + 1
+	dead := attempts >= maxAttempts || errors.Is(err, errUndeliverable)
+	nextAttemptAt := time.Now().UTC().Add(backoff(attempts))
+
+	if dead {
+		log.Printf("Outbox event %d moved to dead-letter after %d attempts: %v", event.ID, attempts, err)
+	}
+	if err := outboxQuery.MarkFailed(event.ID, attempts, nextAttemptAt, err.Error(), dead); err != nil {
+		log.Printf("Failed to record outbox event %d failure: %v", event.ID, err)
+	}
+}
+
+// errUndeliverable marks failures that retrying cannot fix
+var errUndeliverable = errors.New("undeliverable")
+
+// publish sends the event payload to the token's sink
+func publish(event *models.OutboxEvent) error {
+	if event.APIToken == nil {
+		return fmt.Errorf("%w: API token %d not found", errUndeliverable, event.APITokenID)
+	}
+
+	var clickEvent ClickEvent
+	if err := json.Unmarshal([]byte(event.Payload), &clickEvent); err != nil {
+		return fmt.Errorf("%w: invalid payload: %v", errUndeliverable, err)
+	}
+	clickEvent.EventID = event.ID
+
+	sink, err := GetSink(event.APIToken)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := sink.Publish(ctx, &clickEvent); err != nil {
+		// Drop the sink so the next attempt starts from a fresh connection
+		CloseSink(event.APIToken)
+		return err
+	}
+	return nil
+}
+
+// backoff returns the exponential delay before the given attempt is retried
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff << (attempts - 1)
+	if delay <= 0 || delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
+
+// purgeLoop periodically removes old delivered events
+func purgeLoop(outboxQuery *queries.OutboxQuery) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := outboxQuery.PurgeDelivered(time.Now().UTC().Add(-deliveredTTL)); err != nil {
+			log.Printf("Failed to purge delivered outbox events: %v", err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package queue
+
+import (
+	"boilerplate/app/models"
+	"boilerplate/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// fileSink appends click events as JSON lines to a local file,
+// useful to test click delivery without any broker
+type fileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// newFileSink opens (or creates) the file named by the token's sink URL in
+// config.Sink.FileDir
+func newFileSink(token *models.APIToken) (*fileSink, error) {
+	path, err := FileSinkPath(token.SinkURL)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event file: %w", err)
+	}
+	return &fileSink{file: file}, nil
+}
+
+// FileSinkPath returns where a file sink named name writes. The name must be
+// a plain file name, so tokens can't write outside config.Sink.FileDir, and
+// file sinks are refused while no directory is configured.
+func FileSinkPath(name string) (string, error) {
+	if config.Sink.FileDir == "" {
+		return "", errors.New("file sinks are disabled, FILE_SINK_DIR is not set")
+	}
+	if name == "" {
+		return "", errors.New("file name not configured for token")
+	}
+	if filepath.IsAbs(name) || strings.Contains(name, "..") || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("file name %q must not be a path", name)
+	}
+	return filepath.Join(config.Sink.FileDir, name), nil
+}
+
+// Publish writes the event as a single JSON line
+func (s *fileSink) Publish(ctx context.Context, event *ClickEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	return nil
+}
+
+// Ping is a no-op, the file was opened for appending when the sink was created
+func (s *fileSink) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close closes the event file
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
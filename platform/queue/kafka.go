@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"boilerplate/app/models"
+	"boilerplate/pkg/safehttp"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// kafkaSink produces click events to a Kafka topic through a Kafka REST Proxy
+// (v2 API), so no native Kafka client is needed inside the shortener
+type kafkaSink struct {
+	endpoint string
+	username string
+	password string
+	client   *http.Client
+}
+
+// kafkaRecord is a single record in a REST Proxy produce request
+type kafkaRecord struct {
+	Key   string      `json:"key"`
+	Value *ClickEvent `json:"value"`
+}
+
+// newKafkaSink creates a Kafka sink from the token's REST Proxy URL.
+// The sink secret, if set, is used as "user:password" basic auth.
+func newKafkaSink(token *models.APIToken) (*kafkaSink, error) {
+	if token.SinkURL == "" {
+		return nil, fmt.Errorf("kafka REST proxy URL not configured for token")
+	}
+	// Only public addresses, the client refuses internal ones on every dial
+	if err := safehttp.CheckURL(token.SinkURL); err != nil {
+		return nil, fmt.Errorf("kafka REST proxy URL: %w", err)
+	}
+
+	sink := &kafkaSink{
+		endpoint: strings.TrimRight(token.SinkURL, "/") + "/topics/" + url.PathEscape(sinkTopic(token)),
+		client:   safehttp.NewClient(10 * time.Second),
+	}
+	if token.SinkSecret != "" {
+		sink.username, sink.password, _ = strings.Cut(string(token.SinkSecret), ":")
+	}
+	return sink, nil
+}
+
+// Publish produces the event keyed by short code so clicks of a link stay ordered
+func (s *kafkaSink) Publish(ctx context.Context, event *ClickEvent) error {
+	body, err := json.Marshal(map[string][]kafkaRecord{
+		"records": {{Key: event.Code, Value: event}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build kafka request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call kafka REST proxy: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("kafka REST proxy returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Ping fetches the topic metadata, which checks the proxy URL, credentials
+// and that the topic exists
+func (s *kafkaSink) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build kafka request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call kafka REST proxy: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("kafka REST proxy returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close is a no-op, the REST proxy holds the broker connections
+func (s *kafkaSink) Close() error {
+	return nil
+}
@@ -0,0 +1,99 @@
+package queue
+
+import (
+	"boilerplate/app/models"
+	"boilerplate/pkg/safehttp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsSink publishes click events to a NATS subject
+type natsSink struct {
+	conn    *nats.Conn
+	subject string
+}
+
+// newNATSSink connects to the token's NATS server. The sink secret, if set,
+// is used as the NATS auth token.
+func newNATSSink(token *models.APIToken) (*natsSink, error) {
+	if token.SinkURL == "" {
+		return nil, fmt.Errorf("NATS URL not configured for token")
+	}
+	if err := CheckNATSURL(token.SinkURL); err != nil {
+		return nil, err
+	}
+
+	// Servers learned from the cluster are dialed the same way
+	options := []nats.Option{
+		nats.Name("golink-shortener"),
+		nats.SetCustomDialer(safehttp.Dialer(10 * time.Second)),
+	}
+	if token.SinkSecret != "" {
+		options = append(options, nats.Token(string(token.SinkSecret)))
+	}
+
+	conn, err := nats.Connect(token.SinkURL, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	return &natsSink{
+		conn:    conn,
+		subject: sinkTopic(token),
+	}, nil
+}
+
+// CheckNATSURL rejects NATS server lists with a server on localhost or a
+// non-public IP address, the same rule webhook URLs follow
+func CheckNATSURL(servers string) error {
+	for _, server := range strings.Split(servers, ",") {
+		server = strings.TrimSpace(server)
+		if !strings.Contains(server, "://") {
+			server = "nats://" + server
+		}
+		u, err := url.Parse(server)
+		if err != nil || u.Hostname() == "" {
+			return errors.New("must be a list of NATS server URLs")
+		}
+		if err := safehttp.CheckHost(u.Hostname()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Publish sends the event and waits for the server to acknowledge the flush
+func (s *natsSink) Publish(ctx context.Context, event *ClickEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if err := s.conn.Publish(s.subject, body); err != nil {
+		return fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+	if err := s.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("failed to flush NATS connection: %w", err)
+	}
+	return nil
+}
+
+// Ping round-trips to the server
+func (s *natsSink) Ping(ctx context.Context) error {
+	if err := s.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("failed to reach NATS server: %w", err)
+	}
+	return nil
+}
+
+// Close drains and closes the NATS connection
+func (s *natsSink) Close() error {
+	return s.conn.Drain()
+}
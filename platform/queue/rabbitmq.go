@@ -0,0 +1,178 @@
+package queue
+
+import (
+	"boilerplate/app/models"
+	"boilerplate/pkg/safehttp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// rabbitMQSink publishes click events to a RabbitMQ queue
+type rabbitMQSink struct {
+	mu        sync.Mutex
+	amqpURL   string
+	queueName string
+	conn      *amqp.Connection
+	channel   *amqp.Channel
+}
+
+// newRabbitMQSink creates a RabbitMQ sink from the token's broker config
+func newRabbitMQSink(token *models.APIToken) (*rabbitMQSink, error) {
+	// Check if token has RabbitMQ config
+	if token.RabbitMQHost == "" {
+		return nil, fmt.Errorf("RabbitMQ host not configured for token")
+	}
+	if err := safehttp.CheckHost(token.RabbitMQHost); err != nil {
+		return nil, err
+	}
+
+	// Build AMQP URL from token config
+	port := token.RabbitMQPort
+	if port == 0 {
+		port = 5672
+	}
+
+	amqpURL := fmt.Sprintf("amqp://%s:%s@%s:%d/",
+		token.RabbitMQUser,
+		string(token.RabbitMQPassword),
+		token.RabbitMQHost,
+		port,
+	)
+
+	return &rabbitMQSink{
+		amqpURL:   amqpURL,
+		queueName: sinkTopic(token),
+	}, nil
+}
+
+// getChannel returns the open channel, reconnecting if it was closed
+func (s *rabbitMQSink) getChannel() (*amqp.Channel, error) {
+	if s.channel != nil && !s.channel.IsClosed() {
+		return s.channel, nil
+	}
+	s.closeConnection()
+
+	conn, err := amqp.DialConfig(s.amqpURL, amqp.Config{
+		Locale: "en_US",
+		Dial:   dialPublic,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		if closeErr := conn.Close(); closeErr != nil {
+			log.Printf("Failed to close connection after channel error: %v", closeErr)
+		}
+		return nil, fmt.Errorf("failed to open channel: %w", err)
+	}
+
+	// Ensure queue exists
+	_, err = channel.QueueDeclare(
+		s.queueName,
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		if closeErr := conn.Close(); closeErr != nil {
+			log.Printf("Failed to close connection after declare error: %v", closeErr)
+		}
+		return nil, fmt.Errorf("failed to declare queue: %w", err)
+	}
+
+	s.conn = conn
+	s.channel = channel
+	return channel, nil
+}
+
+// dialPublic is amqp.DefaultDial through a dialer that refuses internal
+// addresses, since the broker host is set per token
+func dialPublic(network, addr string) (net.Conn, error) {
+	const timeout = 30 * time.Second
+	conn, err := safehttp.Dialer(timeout).Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	// Cleared by amqp once the handshake is done
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Publish sends the event to the configured queue
+func (s *rabbitMQSink) Publish(ctx context.Context, event *ClickEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channel, err := s.getChannel()
+	if err != nil {
+		return err
+	}
+
+	err = channel.PublishWithContext(
+		ctx,
+		"",          // exchange
+		s.queueName, // routing key
+		false,       // mandatory
+		false,       // immediate
+		amqp.Publishing{
+			ContentType: "application/json",
+			Body:        body,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	return nil
+}
+
+// Ping connects and declares the queue
+func (s *rabbitMQSink) Ping(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.getChannel()
+	return err
+}
+
+// closeConnection closes the current channel and connection, if any
+func (s *rabbitMQSink) closeConnection() {
+	if s.channel != nil && !s.channel.IsClosed() {
+		if err := s.channel.Close(); err != nil {
+			log.Printf("Failed to close RabbitMQ channel: %v", err)
+		}
+	}
+	if s.conn != nil && !s.conn.IsClosed() {
+		if err := s.conn.Close(); err != nil {
+			log.Printf("Failed to close RabbitMQ connection: %v", err)
+		}
+	}
+	s.channel = nil
+	s.conn = nil
+}
+
+// Close closes the RabbitMQ connection
+func (s *rabbitMQSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeConnection()
+	return nil
+}
@@ -0,0 +1,190 @@
+package queue
+
+import (
+	"boilerplate/app/models"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Supported event sink types, selectable per API token
+const (
+	SinkRabbitMQ = "rabbitmq"
+	SinkWebhook  = "webhook"
+	SinkNATS     = "nats"
+	SinkKafka    = "kafka"
+	SinkFile     = "file"
+)
+
+// SinkTypes lists every supported sink type
+var SinkTypes = []string{SinkRabbitMQ, SinkWebhook, SinkNATS, SinkKafka, SinkFile}
+
+// defaultTopic is used as queue, subject or topic name when the token does not set one
+const defaultTopic = "click_events"
+
+// ClickEvent is the payload delivered to every sink
+type ClickEvent struct {
+	EventID     uint   `json:"event_id,omitempty"`
+	Code        string `json:"code"`
+	OriginalURL string `json:"original_url"`
+	ClickedAt   string `json:"clicked_at"`
+	IP          string `json:"ip"`
+	UserAgent   string `json:"user_agent"`
+}
+
+// NewClickEvent creates a click event stamped with the current time
+func NewClickEvent(code, originalURL, ip, userAgent string) *ClickEvent {
+	return &ClickEvent{
+		Code:        code,
+		OriginalURL: originalURL,
+		ClickedAt:   time.Now().UTC().Format(time.RFC3339),
+		IP:          ip,
+		UserAgent:   userAgent,
+	}
+}
+
+// EventSink delivers click events to an external destination.
+// Implementations must be safe for concurrent use.
+type EventSink interface {
+	Publish(ctx context.Context, event *ClickEvent) error
+	// Ping verifies the destination is reachable and accepts the configured
+	// credentials, without delivering a click event
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// IsValidSinkType reports whether sinkType is a supported sink type
+func IsValidSinkType(sinkType string) bool {
+	for _, t := range SinkTypes {
+		if t == sinkType {
+			return true
+		}
+	}
+	return false
+}
+
+// sinkType returns the token's sink type, defaulting to RabbitMQ for older tokens
+func sinkType(token *models.APIToken) string {
+	if token.SinkType == "" {
+		return SinkRabbitMQ
+	}
+	return token.SinkType
+}
+
+// sinkTopic returns the token's queue/subject/topic name or the default one
+func sinkTopic(token *models.APIToken) string {
+	switch sinkType(token) {
+	case SinkRabbitMQ:
+		if token.RabbitMQQueue != "" {
+			return token.RabbitMQQueue
+		}
+	default:
+		if token.SinkTopic != "" {
+			return token.SinkTopic
+		}
+	}
+	return defaultTopic
+}
+
+// sinkPool stores sinks per destination config so connections are reused
+type sinkPool struct {
+	mu    sync.Mutex
+	sinks map[string]EventSink
+}
+
+var pool = &sinkPool{
+	sinks: make(map[string]EventSink),
+}
+
+// getSinkKey generates a unique key for token's sink config
+func getSinkKey(token *models.APIToken) string {
+	switch t := sinkType(token); t {
+	case SinkRabbitMQ:
+		return fmt.Sprintf("%s:%s:%d:%s", t, token.RabbitMQHost, token.RabbitMQPort, token.RabbitMQUser)
+	default:
+		return fmt.Sprintf("%s:%s:%s", t, token.SinkURL, sinkTopic(token))
+	}
+}
+
+// newSink creates the sink configured on the token
+func newSink(token *models.APIToken) (EventSink, error) {
+	switch t := sinkType(token); t {
+	case SinkRabbitMQ:
+		return newRabbitMQSink(token)
+	case SinkWebhook:
+		return newWebhookSink(token)
+	case SinkNATS:
+		return newNATSSink(token)
+	case SinkKafka:
+		return newKafkaSink(token)
+	case SinkFile:
+		return newFileSink(token)
+	default:
+		return nil, fmt.Errorf("unsupported sink type %q", t)
+	}
+}
+
+// GetSink gets or creates the event sink configured on the token
+func GetSink(token *models.APIToken) (EventSink, error) {
+	key := getSinkKey(token)
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if sink, exists := pool.sinks[key]; exists {
+		return sink, nil
+	}
+
+	sink, err := newSink(token)
+	if err != nil {
+		return nil, err
+	}
+	pool.sinks[key] = sink
+	return sink, nil
+}
+
+// CloseSink closes the pooled sink for the token's current config so the next
+// publish reconnects with fresh settings (e.g. after credentials changed)
+func CloseSink(token *models.APIToken) {
+	key := getSinkKey(token)
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if sink, exists := pool.sinks[key]; exists {
+		if err := sink.Close(); err != nil {
+			log.Printf("Failed to close sink %s: %v", key, err)
+		}
+		delete(pool.sinks, key)
+	}
+}
+
+// TestSink checks the token's sink config with a fresh, unpooled sink so the
+// result reflects the stored credentials rather than an existing connection
+func TestSink(ctx context.Context, token *models.APIToken) error {
+	sink, err := newSink(token)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := sink.Close(); err != nil {
+			log.Printf("Failed to close test sink: %v", err)
+		}
+	}()
+	return sink.Ping(ctx)
+}
+
+// Close closes all sinks and their connections
+func Close() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for key, sink := range pool.sinks {
+		if err := sink.Close(); err != nil {
+			log.Printf("Failed to close sink %s: %v", key, err)
+		}
+		delete(pool.sinks, key)
+	}
+}
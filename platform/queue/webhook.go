@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"boilerplate/app/models"
+	"boilerplate/pkg/safehttp"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// webhookSink posts click events as JSON to an HTTP endpoint
+type webhookSink struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// newWebhookSink creates a webhook sink from the token's sink URL and secret
+func newWebhookSink(token *models.APIToken) (*webhookSink, error) {
+	if token.SinkURL == "" {
+		return nil, fmt.Errorf("webhook URL not configured for token")
+	}
+	// Only public addresses, the client refuses internal ones on every dial
+	if err := safehttp.CheckURL(token.SinkURL); err != nil {
+		return nil, fmt.Errorf("webhook URL: %w", err)
+	}
+	return &webhookSink{
+		url:    token.SinkURL,
+		secret: string(token.SinkSecret),
+		client: safehttp.NewClient(10 * time.Second),
+	}, nil
+}
+
+// Publish posts the event to the webhook URL
+func (s *webhookSink) Publish(ctx context.Context, event *ClickEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return s.post(ctx, "click", body)
+}
+
+// Ping posts a {"type":"ping"} body with X-Event-Type: ping, which receivers
+// should acknowledge with a 2xx without treating it as a click
+func (s *webhookSink) Ping(ctx context.Context) error {
+	return s.post(ctx, "ping", []byte(`{"type":"ping"}`))
+}
+
+// post sends body to the webhook URL. When a secret is configured the body
+// is signed with HMAC-SHA256 in the X-Signature-256 header.
+func (s *webhookSink) post(ctx context.Context, eventType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Type", eventType)
+	if s.secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close is a no-op, webhooks hold no connection
+func (s *webhookSink) Close() error {
+	return nil
+}
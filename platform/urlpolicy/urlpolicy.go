@@ -0,0 +1,325 @@
+package urlpolicy
+
+import (
+	"boilerplate/app/models"
+	"boilerplate/app/queries"
+	"boilerplate/config"
+	"boilerplate/pkg/problem"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/idna"
+	"gorm.io/gorm"
+)
+
+// reloadInterval is how often the blocklist file is checked for changes
+const reloadInterval = time.Minute
+
+// Violation is returned by Check when a URL is rejected by the policy. Type
+// is the problem type of the rule that rejected it.
+type Violation struct {
+	Type   string
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return v.Reason
+}
+
+// BlocklistStatus describes the loaded phishing/malware hash list
+type BlocklistStatus struct {
+	File     string    `json:"file"`
+	Entries  int       `json:"entries"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// blocklist is an immutable set of SHA-256 hashes, swapped whole on reload
+type blocklist struct {
+	hashes  map[string]struct{}
+	modTime time.Time
+	status  BlocklistStatus
+}
+
+var (
+	db      *gorm.DB
+	policy  *config.URLPolicyConfig
+	schemes map[string]bool
+	hashes  atomic.Pointer[blocklist]
+)
+
+// Start sets up the policy and loads the blocklist file, if configured. The
+// file is watched and reloaded when it changes. Exits if the file can't be read.
+func Start(database *gorm.DB, cfg *config.URLPolicyConfig) {
+	db = database
+	policy = cfg
+
+	schemes = make(map[string]bool, len(cfg.AllowedSchemes))
+	for _, scheme := range cfg.AllowedSchemes {
+		schemes[scheme] = true
+	}
+
+	if cfg.BlocklistFile == "" {
+		return
+	}
+	list, err := loadBlocklist(cfg.BlocklistFile)
+	if err != nil {
+		log.Fatal("Failed to load URL blocklist:", err)
+	}
+	hashes.Store(list)
+	log.Printf("URL blocklist loaded: %d entries from %s", list.status.Entries, cfg.BlocklistFile)
+
+	go watch(cfg.BlocklistFile)
+}
+
+// Status returns the state of the blocklist, or nil if none is configured
+func Status() *BlocklistStatus {
+	list := hashes.Load()
+	if list == nil {
+		return nil
+	}
+	status := list.status
+	return &status
+}
+
+// Check screens a link destination. It returns a *Violation when the URL is
+// rejected, or another error when the domain rules can't be read. ownHosts
+// are short domains in addition to the configured ones, e.g. the request host.
+func Check(rawURL string, ownHosts ...string) error {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Scheme == "" {
+		return &Violation{Type: problem.TypeInvalidURL, Reason: "original_url must be an absolute URL"}
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if !schemes[scheme] {
+		return &Violation{Type: problem.TypeURLSchemeNotAllowed, Reason: fmt.Sprintf("URL scheme %q is not allowed", scheme)}
+	}
+	if u.Host == "" {
+		return &Violation{Type: problem.TypeInvalidURL, Reason: "original_url must be an absolute URL"}
+	}
+	// https://trusted.example@evil.example/ hides the real host from readers
+	if u.User != nil {
+		return &Violation{Type: problem.TypeURLCredentials, Reason: "URLs with embedded credentials are not allowed"}
+	}
+
+	host, ip, err := canonicalHost(u)
+	if err != nil {
+		return &Violation{Type: problem.TypeInvalidURL, Reason: "original_url has an invalid host"}
+	}
+
+	for _, hosts := range [][]string{policy.OwnHosts, ownHosts} {
+		for _, own := range hosts {
+			if matchesDomain(host, canonicalOwnHost(own)) {
+				return &Violation{Type: problem.TypeURLSelfReference, Reason: "Links to our own short domain are not allowed"}
+			}
+		}
+	}
+
+	domains := []string{host}
+	if !ip {
+		domains = parentDomains(host)
+	}
+
+	ruleQuery := &queries.DomainRuleQuery{DB: db}
+	rule, err := ruleQuery.MostSpecific(domains)
+	if err != nil {
+		return err
+	}
+	if rule != nil && rule.Action == models.DomainRuleAllow {
+		// Allow rules are exceptions to the block rules and the blocklist
+		return nil
+	}
+	if rule != nil && rule.Action == models.DomainRuleBlock {
+		return &Violation{Type: problem.TypeURLDomainBlocked, Reason: fmt.Sprintf("Domain %s is blocked", rule.Domain)}
+	}
+	if policy.AllowlistOnly {
+		return &Violation{Type: problem.TypeURLDomainNotAllowed, Reason: fmt.Sprintf("Domain %s is not on the allow list", host)}
+	}
+
+	if list := hashes.Load(); list != nil {
+		for _, expr := range expressions(host, ip, u) {
+			sum := sha256.Sum256([]byte(expr))
+			if _, listed := list.hashes[hex.EncodeToString(sum[:])]; listed {
+				return &Violation{Type: problem.TypeURLBlocklisted, Reason: "Destination is listed as phishing or malware"}
+			}
+		}
+	}
+
+	return nil
+}
+
+// NormalizeDomain turns user input like "*.Example.com." or a full URL into
+// the bare lowercase ASCII domain a rule is stored under
+func NormalizeDomain(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if strings.Contains(input, "://") {
+		u, err := url.Parse(input)
+		if err != nil {
+			return "", err
+		}
+		input = u.Hostname()
+	}
+	input = strings.TrimPrefix(strings.TrimPrefix(input, "*"), ".")
+
+	if ip := net.ParseIP(input); ip != nil {
+		return ip.String(), nil
+	}
+
+	host, _, err := canonicalHost(&url.URL{Host: input})
+	if err != nil || host == "" || strings.ContainsAny(host, "/:@ ") {
+		return "", fmt.Errorf("invalid domain %q", input)
+	}
+	return host, nil
+}
+
+// canonicalHost lowercases the host, drops a trailing dot and converts
+// internationalized names to punycode, so lookalike Unicode hosts can't
+// sidestep the rules. ip reports whether the host is an IP address.
+func canonicalHost(u *url.URL) (host string, ip bool, err error) {
+	host = strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if parsed := net.ParseIP(host); parsed != nil {
+		return parsed.String(), true, nil
+	}
+	host, err = idna.Lookup.ToASCII(host)
+	return host, false, err
+}
+
+// canonicalOwnHost normalizes a configured or request host for comparison
+func canonicalOwnHost(host string) string {
+	canonical, _, err := canonicalHost(&url.URL{Host: host})
+	if err != nil {
+		return strings.ToLower(host)
+	}
+	return canonical
+}
+
+// matchesDomain reports whether host is domain or one of its subdomains
+func matchesDomain(host, domain string) bool {
+	return domain != "" && (host == domain || strings.HasSuffix(host, "."+domain))
+}
+
+// parentDomains returns the host followed by each parent domain, e.g.
+// a.b.example.com, b.example.com, example.com, com
+func parentDomains(host string) []string {
+	domains := []string{host}
+	for i := 0; i < len(host); i++ {
+		if host[i] == '.' {
+			domains = append(domains, host[i+1:])
+		}
+	}
+	return domains
+}
+
+// expressions returns the host/path combinations looked up in the blocklist,
+// in the spirit of Safe Browsing: each parent domain (down to two labels) with
+// "/", the path, and the path with query
+func expressions(host string, ip bool, u *url.URL) []string {
+	hosts := []string{host}
+	if !ip {
+		hosts = hosts[:0]
+		for _, domain := range parentDomains(host) {
+			if strings.Contains(domain, ".") {
+				hosts = append(hosts, domain)
+			}
+		}
+	}
+
+	paths := []string{"/"}
+	if path := u.EscapedPath(); path != "" && path != "/" {
+		paths = append(paths, path)
+		if u.RawQuery != "" {
+			paths = append(paths, path+"?"+u.RawQuery)
+		}
+	} else if u.RawQuery != "" {
+		paths = append(paths, "/?"+u.RawQuery)
+	}
+
+	var exprs []string
+	for _, h := range hosts {
+		for _, p := range paths {
+			exprs = append(exprs, h+p)
+		}
+	}
+	return exprs
+}
+
+// loadBlocklist reads hex SHA-256 hashes, one per line. Blank lines and lines
+// starting with # are ignored.
+func loadBlocklist(path string) (*blocklist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	list := &blocklist{
+		hashes:  make(map[string]struct{}),
+		modTime: info.ModTime(),
+	}
+	invalid := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := hex.DecodeString(line); err != nil || len(line) != sha256.Size*2 {
+			invalid++
+			continue
+		}
+		list.hashes[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if invalid > 0 {
+		log.Printf("URL blocklist %s: skipped %d invalid lines", path, invalid)
+	}
+
+	list.status = BlocklistStatus{
+		File:     path,
+		Entries:  len(list.hashes),
+		LoadedAt: time.Now(),
+	}
+	return list, nil
+}
+
+// watch reloads the blocklist whenever the file's modification time changes.
+// On errors the previous list stays in use.
+func watch(path string) {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Printf("URL blocklist: %v", err)
+			continue
+		}
+		if info.ModTime().Equal(hashes.Load().modTime) {
+			continue
+		}
+
+		list, err := loadBlocklist(path)
+		if err != nil {
+			log.Printf("URL blocklist reload failed, keeping previous list: %v", err)
+			continue
+		}
+		hashes.Store(list)
+		log.Printf("URL blocklist reloaded: %d entries from %s", list.status.Entries, path)
+	}
+}
@@ -0,0 +1,194 @@
+package urlpolicy
+
+import (
+	"boilerplate/config"
+	"boilerplate/pkg/problem"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// start sets up the policy with a database that never connects: in dry run
+// mode every domain rule lookup finds nothing
+func start(t *testing.T, cfg *config.URLPolicyConfig) {
+	t.Helper()
+
+	database, err := gorm.Open(postgres.Open("host=localhost dbname=test"), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatalf("gorm.Open() error = %v", err)
+	}
+
+	hashes.Store(nil)
+	Start(database, cfg)
+}
+
+// checkType runs Check and returns the violation type, "" if the URL passed
+func checkType(t *testing.T, rawURL string, ownHosts ...string) string {
+	t.Helper()
+
+	err := Check(rawURL, ownHosts...)
+	if err == nil {
+		return ""
+	}
+	var violation *Violation
+	if !errors.As(err, &violation) {
+		t.Fatalf("Check(%q) error = %v, want a *Violation", rawURL, err)
+	}
+	return violation.Type
+}
+
+func TestCheckScheme(t *testing.T) {
+	start(t, &config.URLPolicyConfig{AllowedSchemes: []string{"http", "https"}})
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://example.com/", want: ""},
+		{url: "http://example.com/path?q=1", want: ""},
+		{url: "HTTPS://example.com/", want: ""},
+		{url: "ftp://example.com/file", want: problem.TypeURLSchemeNotAllowed},
+		{url: "javascript:alert(1)", want: problem.TypeURLSchemeNotAllowed},
+		{url: "data:text/html,hi", want: problem.TypeURLSchemeNotAllowed},
+		{url: "example.com/path", want: problem.TypeInvalidURL},
+		{url: "https:///path", want: problem.TypeInvalidURL},
+		{url: "https://trusted.example@evil.example/", want: problem.TypeURLCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := checkType(t, tt.url); got != tt.want {
+				t.Errorf("Check(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckOwnHosts(t *testing.T) {
+	start(t, &config.URLPolicyConfig{
+		AllowedSchemes: []string{"http", "https"},
+		OwnHosts:       []string{"sho.rt"},
+	})
+
+	tests := []struct {
+		name     string
+		url      string
+		ownHosts []string
+		want     string
+	}{
+		{name: "configured host", url: "https://sho.rt/abc", want: problem.TypeURLSelfReference},
+		{name: "case and trailing dot", url: "https://SHO.RT./abc", want: problem.TypeURLSelfReference},
+		{name: "subdomain", url: "http://www.sho.rt/", want: problem.TypeURLSelfReference},
+		{name: "with port", url: "https://sho.rt:8443/abc", want: problem.TypeURLSelfReference},
+		{name: "suffix without dot", url: "https://notsho.rt/", want: ""},
+		{name: "parent domain", url: "https://rt/", want: ""},
+		{name: "request host", url: "https://brand.example/x", ownHosts: []string{"brand.example:3000"}, want: problem.TypeURLSelfReference},
+		{name: "other host", url: "https://example.com/", ownHosts: []string{"brand.example"}, want: ""},
+		{name: "empty request host", url: "https://example.com/", ownHosts: []string{""}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkType(t, tt.url, tt.ownHosts...); got != tt.want {
+				t.Errorf("Check(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckBlocklist(t *testing.T) {
+	var lines []string
+	for _, expr := range []string{"evil.example/", "example.com/bad/path", "example.com/q?id=1", "10.1.2.3/"} {
+		sum := sha256.Sum256([]byte(expr))
+		lines = append(lines, hex.EncodeToString(sum[:]))
+	}
+	lines = append(lines, "# comment", "", "not a hash")
+
+	file := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	start(t, &config.URLPolicyConfig{
+		AllowedSchemes: []string{"http", "https"},
+		BlocklistFile:  file,
+	})
+
+	if status := Status(); status == nil || status.Entries != 4 {
+		t.Fatalf("Status() = %+v, want 4 entries", status)
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://evil.example/", want: problem.TypeURLBlocklisted},
+		{url: "https://evil.example/any/path?x=1", want: problem.TypeURLBlocklisted},
+		{url: "https://login.evil.example/", want: problem.TypeURLBlocklisted},
+		{url: "https://EVIL.example./", want: problem.TypeURLBlocklisted},
+		{url: "https://example.com/bad/path", want: problem.TypeURLBlocklisted},
+		{url: "https://example.com/bad/path?utm=1", want: problem.TypeURLBlocklisted},
+		{url: "https://example.com/q?id=1", want: problem.TypeURLBlocklisted},
+		{url: "http://10.1.2.3/admin", want: problem.TypeURLBlocklisted},
+		{url: "https://example.com/", want: ""},
+		{url: "https://example.com/bad", want: ""},
+		{url: "https://example.com/q?id=2", want: ""},
+		{url: "https://notevil.example/", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := checkType(t, tt.url); got != tt.want {
+				t.Errorf("Check(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAllowlistOnly(t *testing.T) {
+	start(t, &config.URLPolicyConfig{
+		AllowedSchemes: []string{"https"},
+		AllowlistOnly:  true,
+	})
+
+	if got := checkType(t, "https://example.com/"); got != problem.TypeURLDomainNotAllowed {
+		t.Errorf("Check() = %q, want %q", got, problem.TypeURLDomainNotAllowed)
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "Example.COM", want: "example.com"},
+		{input: "*.example.com.", want: "example.com"},
+		{input: "https://sub.example.com/path", want: "sub.example.com"},
+		{input: "bücher.example", want: "xn--bcher-kva.example"},
+		{input: "10.0.0.1", want: "10.0.0.1"},
+		{input: "", wantErr: true},
+		{input: "exa mple.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := NormalizeDomain(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeDomain(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeDomain(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -56,12 +56,14 @@ if aws ssm get-parameter --name /golink-shorner/db/host --region $REGION --query
     DB_USER=$(aws ssm get-parameter --name /golink-shorner/db/user --region $REGION --query 'Parameter.Value' --output text 2>/dev/null || echo "onjourney")
     DB_PASSWORD=$(aws ssm get-parameter --name /golink-shorner/db/password --with-decryption --region $REGION --query 'Parameter.Value' --output text 2>/dev/null || echo "")
     DB_NAME=$(aws ssm get-parameter --name /golink-shorner/db/name --region $REGION --query 'Parameter.Value' --output text 2>/dev/null || echo "onjourney_link")
+    ENCRYPTION_KEY=$(aws ssm get-parameter --name /golink-shorner/app/encryption-key --with-decryption --region $REGION --query 'Parameter.Value' --output text 2>/dev/null || echo "")
     
     # Validate required values
-    if [ -z "$DB_HOST" ] || [ -z "$DB_PASSWORD" ]; then
+    if [ -z "$DB_HOST" ] || [ -z "$DB_PASSWORD" ] || [ -z "$ENCRYPTION_KEY" ]; then
         echo "[ERROR] ERROR: Failed to retrieve required credentials from Parameter Store"
         echo "   DB_HOST: ${DB_HOST:-MISSING}"
         echo "   DB_PASSWORD: ${DB_PASSWORD:+SET}${DB_PASSWORD:-MISSING}"
+        echo "   ENCRYPTION_KEY: ${ENCRYPTION_KEY:+SET}${ENCRYPTION_KEY:-MISSING}"
         exit 1
     fi
     
@@ -75,6 +77,9 @@ DB_USER=${DB_USER}
 DB_PASSWORD=${DB_PASSWORD}
 DB_NAME=${DB_NAME}
 DB_SSLMODE=require
+
+# Master key for credentials encrypted at rest
+ENCRYPTION_KEY=${ENCRYPTION_KEY}
 EOF
     
     chmod 600 /home/ec2-user/.env
@@ -85,12 +90,13 @@ EOF
     echo "   DB_USER: $DB_USER"
     echo "   DB_NAME: $DB_NAME"
     echo "   DB_PASSWORD: [REDACTED]"
+    echo "   ENCRYPTION_KEY: [REDACTED]"
 else
     echo "[ERROR] ERROR: Parameter Store not accessible"
     echo "Please ensure:"
     echo '  1. Parameter Store is configured (see docs/AWS_SETUP.md)'
     echo '  2. IAM role has Parameter Store access (SecretsManagerReadWrite policy)'
-    echo '  3. Parameters exist: /golink-shorner/db/*'
+    echo '  3. Parameters exist: /golink-shorner/db/* and /golink-shorner/app/encryption-key'
     exit 1
 fi
 
@@ -103,10 +109,11 @@ fi
 # Validate that all required values are set
 if ! grep -q "^DB_HOST=" /home/ec2-user/.env || \
    ! grep -q "^DB_PASSWORD=" /home/ec2-user/.env || \
-   grep -q "^DB_PASSWORD=$" /home/ec2-user/.env; then
+   grep -q "^DB_PASSWORD=$" /home/ec2-user/.env || \
+   grep -q "^ENCRYPTION_KEY=$" /home/ec2-user/.env; then
     echo "[ERROR] ERROR: .env file is incomplete or invalid"
     echo "Current .env content:"
-    cat /home/ec2-user/.env | sed 's/DB_PASSWORD=.*/DB_PASSWORD=[REDACTED]/'
+    cat /home/ec2-user/.env | sed 's/DB_PASSWORD=.*/DB_PASSWORD=[REDACTED]/; s/ENCRYPTION_KEY=.*/ENCRYPTION_KEY=[REDACTED]/'
     exit 1
 fi
 
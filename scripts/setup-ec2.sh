@@ -112,6 +112,7 @@ if [ ! -f /home/ec2-user/.env ]; then
         DB_USER=$(aws ssm get-parameter --name /golink-shorner/db/user --region ap-southeast-1 --query 'Parameter.Value' --output text 2>/dev/null || echo "onjourney")
         DB_PASSWORD=$(aws ssm get-parameter --name /golink-shorner/db/password --with-decryption --region ap-southeast-1 --query 'Parameter.Value' --output text 2>/dev/null || echo "")
         DB_NAME=$(aws ssm get-parameter --name /golink-shorner/db/name --region ap-southeast-1 --query 'Parameter.Value' --output text 2>/dev/null || echo "onjourney_link")
+        ENCRYPTION_KEY=$(aws ssm get-parameter --name /golink-shorner/app/encryption-key --with-decryption --region ap-southeast-1 --query 'Parameter.Value' --output text 2>/dev/null || echo "")
         
         # Create .env file with retrieved values
         cat > /home/ec2-user/.env << EOF
@@ -122,9 +123,12 @@ DB_USER=${DB_USER}
 DB_PASSWORD=${DB_PASSWORD}
 DB_NAME=${DB_NAME}
 DB_SSLMODE=require
+
+# Master key for credentials encrypted at rest
+ENCRYPTION_KEY=${ENCRYPTION_KEY}
 EOF
         
-        if [ -z "$DB_HOST" ] || [ -z "$DB_PASSWORD" ]; then
+        if [ -z "$DB_HOST" ] || [ -z "$DB_PASSWORD" ] || [ -z "$ENCRYPTION_KEY" ]; then
             echo "⚠️  Warning: Some parameters missing from Parameter Store. Please verify."
         else
             echo "✅ Successfully retrieved credentials from Parameter Store"
@@ -142,6 +146,7 @@ EOF
         echo "     - /golink-shorner/db/user"
         echo "     - /golink-shorner/db/password (SecureString)"
         echo "     - /golink-shorner/db/name"
+        echo "     - /golink-shorner/app/encryption-key (SecureString)"
         echo ""
         echo "See docs/AWS_SETUP.md section 6 for detailed instructions."
         exit 1
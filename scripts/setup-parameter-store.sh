@@ -35,6 +35,9 @@ fi
 read -p "Database Name [onjourney_link]: " DB_NAME
 DB_NAME=${DB_NAME:-onjourney_link}
 
+read -sp "Encryption Key (base64, 32 bytes) [keep existing or generate]: " ENCRYPTION_KEY
+echo ""
+
 echo ""
 echo "Creating parameters in Parameter Store..."
 echo ""
@@ -89,6 +92,28 @@ aws ssm put-parameter \
     --region "$AWS_REGION" \
     --overwrite 2>/dev/null && echo "✅ Created/Updated" || echo "⚠️  Already exists (use --overwrite to update)"
 
+# Create encryption key parameter (SecureString). An existing key is never
+# replaced implicitly: secrets encrypted with it would become unreadable.
+echo "Creating /golink-shorner/app/encryption-key (SecureString)..."
+if [ -n "$ENCRYPTION_KEY" ]; then
+    aws ssm put-parameter \
+        --name "/golink-shorner/app/encryption-key" \
+        --type "SecureString" \
+        --value "$ENCRYPTION_KEY" \
+        --description "Master key for credentials encrypted at rest (encrypted)" \
+        --region "$AWS_REGION" \
+        --overwrite 2>/dev/null && echo "✅ Created/Updated (encrypted)" || echo "⚠️  Failed to update"
+elif aws ssm get-parameter --name "/golink-shorner/app/encryption-key" --region "$AWS_REGION" > /dev/null 2>&1; then
+    echo "✅ Already exists, keeping current key"
+else
+    aws ssm put-parameter \
+        --name "/golink-shorner/app/encryption-key" \
+        --type "SecureString" \
+        --value "$(openssl rand -base64 32)" \
+        --description "Master key for credentials encrypted at rest (encrypted)" \
+        --region "$AWS_REGION" 2>/dev/null && echo "✅ Generated new key (encrypted)" || echo "⚠️  Failed to create"
+fi
+
 echo ""
 echo "=========================================="
 echo "✅ Parameter Store setup completed!"